@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	builder "github.com/groenlid/docker-builder/cmd/builders"
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// getChangedFiles returns the absolute paths of the files that differ between the given ref
+// and the working tree of the git repository containing repositoryPath.
+// Both committed, staged, unstaged and untracked changes are included.
+func getChangedFiles(repositoryPath string, ref string) ([]string, error) {
+	repository, err := git.PlainOpenWithOptions(repositoryPath, &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refHash, err := repository.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+	refCommit, err := repository.CommitObject(*refHash)
+	if err != nil {
+		return nil, err
+	}
+	refTree, err := refCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(refTree, headTree)
+	if err != nil {
+		return nil, err
+	}
+
+	changedFiles := []string{}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			changedFiles = append(changedFiles, change.From.Name)
+		}
+		if change.To.Name != "" {
+			changedFiles = append(changedFiles, change.To.Name)
+		}
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	for file, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			changedFiles = append(changedFiles, file)
+		}
+	}
+
+	root := worktree.Filesystem.Root()
+	absolutePaths := []string{}
+	for _, changedFile := range unique(changedFiles) {
+		absolutePath := filepath.Join(root, filepath.FromSlash(changedFile))
+		if isInSkippedFolder(root, changedFile) || isToolOutputPath(absolutePath) {
+			continue
+		}
+		absolutePaths = append(absolutePaths, absolutePath)
+	}
+	return absolutePaths, nil
+}
+
+// isInSkippedFolder returns true for the files that are never part of a build context, like the .builder folder.
+func isInSkippedFolder(root string, file string) bool {
+	folder := root
+	segments := strings.Split(file, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		folder = filepath.Join(folder, segment)
+		if isSkippedFolder(folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAffectingPaths returns the paths where a change should trigger a new build of the service.
+func getAffectingPaths(configuration structs.ConfigurationWithProjectPath, arguments *builder.BuildArguments) []string {
+	paths := []string{configuration.ProjectPath}
+	if len(arguments.SourcePaths) > 0 {
+		return append(paths, arguments.SourcePaths...)
+	}
+	for contextPath := range arguments.DockerBuildContextPaths {
+		paths = append(paths, contextPath)
+	}
+	return paths
+}
+
+func containsChangedFile(folder string, changedFiles []string) (bool, error) {
+	absoluteFolder, err := filepath.Abs(folder)
+	if err != nil {
+		return false, err
+	}
+	for _, changedFile := range changedFiles {
+		if changedFile == absoluteFolder || strings.HasPrefix(changedFile, absoluteFolder+string(os.PathSeparator)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filterAffectedConfigurations returns the services with changed files in their build context since the given ref.
+func filterAffectedConfigurations(configurations []structs.ConfigurationWithProjectPath, ref string) ([]structs.ConfigurationWithProjectPath, error) {
+	changedFiles, err := getChangedFiles(".", ref)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Found %d changed files since %s", len(changedFiles), ref)
+
+	affected := []structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		arguments, err := builder.Manager.GetBuildArgumentsForProject(configuration)
+		if err != nil {
+			return nil, newServiceError(configuration, phaseBuilder, err)
+		}
+		if arguments == nil {
+			continue
+		}
+		defer arguments.Cleanup()
+
+		for _, affectingPath := range getAffectingPaths(configuration, arguments) {
+			isAffected, err := containsChangedFile(affectingPath, changedFiles)
+			if err != nil {
+				return nil, newServiceError(configuration, phaseContext, err)
+			}
+			if isAffected {
+				affected = append(affected, configuration)
+				break
+			}
+		}
+	}
+
+	log.Printf("%d of %d services are affected by the changes since %s", len(affected), len(configurations), ref)
+	return affected, nil
+}
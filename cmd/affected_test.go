@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+func commitAll(t *testing.T, worktree *git.Worktree, message string) string {
+	if err := worktree.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+// setupAffectedRepository creates a git repository with two manual services and a dotnet service
+// referencing a library outside its folder. It returns the configurations and the initial commit.
+func setupAffectedRepository(t *testing.T) (*git.Worktree, []structs.ConfigurationWithProjectPath, string) {
+	chdirToTempDir(t)
+	repository, err := git.PlainInit(".", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, "README.md", "# services\n")
+	writeTestFile(t, filepath.Join("api", "Dockerfile"), "FROM scratch\n")
+	writeTestFile(t, filepath.Join("web", "Dockerfile"), "FROM scratch\n")
+	writeTestFile(t, filepath.Join("worker", "Worker.csproj"), `<Project Sdk="Microsoft.NET.Sdk">
+  <ItemGroup>
+    <ProjectReference Include="..\lib\Lib.csproj" />
+  </ItemGroup>
+</Project>
+`)
+	writeTestFile(t, filepath.Join("lib", "Lib.csproj"), `<Project Sdk="Microsoft.NET.Sdk" />`+"\n")
+	initialCommit := commitAll(t, worktree, "initial")
+
+	manual := json.RawMessage(`{"type":"manual","buildcontext":"projectdir"}`)
+	configurations := []structs.ConfigurationWithProjectPath{
+		{Configuration: structs.Configuration{ServiceName: "api", Builder: manual}, ProjectPath: "api"},
+		{Configuration: structs.Configuration{ServiceName: "web", Builder: manual}, ProjectPath: "web"},
+		{Configuration: structs.Configuration{ServiceName: "worker", Builder: json.RawMessage(`{"type":"dotnet"}`)}, ProjectPath: "worker"},
+	}
+	return worktree, configurations, initialCommit
+}
+
+func getServiceNames(configurations []structs.ConfigurationWithProjectPath) []string {
+	names := []string{}
+	for _, configuration := range configurations {
+		names = append(names, configuration.ServiceName)
+	}
+	return names
+}
+
+func TestFilterAffectedConfigurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(t *testing.T, worktree *git.Worktree)
+		expected []string
+	}{
+		{
+			name: "committed change",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, filepath.Join("api", "main.go"), "package main\n")
+				commitAll(t, worktree, "change api")
+			},
+			expected: []string{"api"},
+		},
+		{
+			name: "staged change",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, filepath.Join("web", "Dockerfile"), "FROM nginx\n")
+				if _, err := worktree.Add("web/Dockerfile"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []string{"web"},
+		},
+		{
+			name: "unstaged change",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, filepath.Join("web", "Dockerfile"), "FROM nginx\n")
+			},
+			expected: []string{"web"},
+		},
+		{
+			name: "untracked file",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, filepath.Join("api", "config.json"), "{}\n")
+			},
+			expected: []string{"api"},
+		},
+		{
+			name: "change in a referenced project",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, filepath.Join("lib", "Class.cs"), "class Lib {}\n")
+				commitAll(t, worktree, "change lib")
+			},
+			expected: []string{"worker"},
+		},
+		{
+			name: "change outside every service",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, "README.md", "# all services\n")
+				commitAll(t, worktree, "change readme")
+			},
+			expected: []string{},
+		},
+		{
+			name: "tool outputs",
+			change: func(t *testing.T, worktree *git.Worktree) {
+				writeTestFile(t, digestCachePath, "{}\n")
+				writeTestFile(t, filepath.Join("artifacts", "services", "api.yaml"), "kind: Deployment\n")
+				writeTestFile(t, filepath.Join(".builder", "contexts", "1.tar"), "")
+			},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worktree, configurations, initialCommit := setupAffectedRepository(t)
+			test.change(t, worktree)
+
+			affected, err := filterAffectedConfigurations(configurations, initialCommit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := getServiceNames(affected); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected the services %v to be affected, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestGetChangedFilesSinceBranch(t *testing.T) {
+	worktree, _, _ := setupAffectedRepository(t)
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: "refs/heads/feature", Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join("api", "main.go"), "package main\n")
+	commitAll(t, worktree, "change api")
+
+	changedFiles, err := getChangedFiles(".", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := filepath.Abs(filepath.Join("api", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changedFiles, []string{expected}) {
+		t.Errorf("expected %v to have changed since master, got %v", []string{expected}, changedFiles)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,6 +18,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/client"
@@ -37,51 +39,211 @@ var buildCmd = &cobra.Command{
 	},
 }
 
-var foldersToSkip = []string{"node_modules", ".git", "bin", ".builder"}
+var foldersToSkip = []string{"node_modules", ".git", ".builder", ".venv", "__pycache__"}
 var tmpFolder = ".builder"
 
+const digestCachePath = ".digestcache"
+
+// toolOutputPaths are the files and folders docker-builder writes to the working directory.
+// They change on every build, so they are never part of a build context.
+var toolOutputPaths = []string{digestCachePath, "artifacts", "release"}
+
+func addToolOutputPath(path string) {
+	toolOutputPaths = append(toolOutputPaths, path)
+}
+
+// isToolOutputPath returns true for the tool outputs and the files inside them.
+func isToolOutputPath(path string) bool {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, toolOutputPath := range toolOutputPaths {
+		absoluteToolOutputPath, err := filepath.Abs(toolOutputPath)
+		if err != nil {
+			continue
+		}
+		if absolutePath == absoluteToolOutputPath || isSubfolder(absoluteToolOutputPath, absolutePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSkippedFolder returns true for the folders that are never part of a build context.
+// The bin folder is only skipped next to a dotnet project file, where it holds the build output,
+// as other builds keep sources in it, like the binaries of cargo in src/bin.
+func isSkippedFolder(path string) bool {
+	name := filepath.Base(path)
+	for _, folderToSkip := range foldersToSkip {
+		if folderToSkip == name {
+			return true
+		}
+	}
+	return name == "bin" && hasDotnetProjectFile(filepath.Dir(path))
+}
+
+func hasDotnetProjectFile(folder string) bool {
+	for _, pattern := range []string{"*.csproj", "*.fsproj", "*.vbproj"} {
+		if matches, _ := filepath.Glob(filepath.Join(folder, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.Flags().StringP("registryUsername", "u", "", "The username for the docker registry being used")
 	buildCmd.Flags().StringP("registryPassword", "p", "", "The password for the docker registry being used")
 	buildCmd.Flags().StringP("registry", "r", "", "The docker registry being used")
+	buildCmd.Flags().String("tag", "latest", "The tag given to the images pushed to the docker registry")
+	buildCmd.Flags().Int("parallel", 1, "The number of services to build and push at the same time")
+	buildCmd.Flags().String("namespace", defaultNamespace, "The kubernetes namespace the services are deployed to")
+	buildCmd.Flags().String("artifacts", "artifacts", "The folder the rendered deployment files are written to")
+	addServiceSelectionFlags(buildCmd.Flags())
+	buildCmd.Flags().String("since", "", "Only build the services with changes in their build context since the given git ref, like origin/main")
 
 	buildCmd.MarkFlagRequired("registryUsername")
-	buildCmd.MarkFlagRequired("registryPassord")
+	buildCmd.MarkFlagRequired("registryPassword")
 
 }
 
 func runBuild(cmd *cobra.Command, args []string) {
-	digestCachePath := ".digestcache"
 	digestCache := getDigestCache(digestCachePath)
 
 	flags := cmd.Flags()
 	dockerusername, _ := flags.GetString("registryUsername")
 	dockerpassword, _ := flags.GetString("registryPassword")
 	dockerregistry, _ := flags.GetString("registry")
-
+	if dockerregistry == "" {
+		exitWithConfigError(errors.New("--registry must be given, the images would otherwise be pushed to docker hub"))
+	}
+	tag, _ := flags.GetString("tag")
+	parallel, _ := flags.GetInt("parallel")
+	if parallel < 1 {
+		exitWithConfigError(errors.New("--parallel must be at least 1"))
+	}
+	namespace, _ := flags.GetString("namespace")
+	artifactsFolder, _ := flags.GetString("artifacts")
+	addToolOutputPath(artifactsFolder)
 	authString, err := getRegistryAuthString(dockerusername, dockerpassword, dockerregistry)
 	if err != nil {
-		log.Fatalln(err)
+		exitWithConfigError(err)
 	}
-	configurations, err := findYT3ConfigurationFiles(".")
+	configurations := discoverConfigurations(flags)
 
-	if err != nil {
-		log.Fatalln(err)
+	if since, _ := flags.GetString("since"); since != "" {
+		configurations, err = filterAffectedConfigurations(configurations, since)
+		if err != nil {
+			exitWithConfigError(err)
+		}
 	}
 
 	ctx := context.Background()
 
-	buildAndPushImages(ctx, configurations, authString)
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	if err := cleanArtifactFolders(artifactsFolder, configurations); err != nil {
+		exitWithConfigError(err)
+	}
+
+	settings := buildSettings{
+		Registry:        dockerregistry,
+		Tag:             tag,
+		Auth:            authString,
+		Parallel:        parallel,
+		Namespace:       namespace,
+		ArtifactsFolder: artifactsFolder,
+	}
+
+	results := buildAndPushImages(ctx, cli, configurations, digestCache, settings)
 
 	persitDigestCache(digestCachePath, digestCache)
+
+	report := newBuildReport(results)
+	report.print()
+	if exitCode := report.exitCode(); exitCode != exitCodeSuccess {
+		os.Exit(exitCode)
+	}
+}
+
+// buildSettings holds the settings given to the build command that are shared by every service.
+type buildSettings struct {
+	Registry        string
+	Tag             string
+	Auth            string
+	Parallel        int
+	Namespace       string
+	ArtifactsFolder string
+}
+
+// cleanArtifactFolders removes the cluster folders of the artifacts about to be written, so the artifacts of removed services do not linger.
+// The folders are removed recursively, so the artifacts folder must be a subfolder of the working directory.
+func cleanArtifactFolders(artifactsFolder string, configurations []structs.ConfigurationWithProjectPath) error {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	absoluteArtifactsFolder, err := filepath.Abs(artifactsFolder)
+	if err != nil {
+		return err
+	}
+	if !isSubfolder(workingDirectory, absoluteArtifactsFolder) {
+		return fmt.Errorf("--artifacts must be a subfolder of the working directory. given %s", artifactsFolder)
+	}
+
+	cleaned := map[string]bool{}
+	for _, configuration := range configurations {
+		clusterFolder := filepath.Join(absoluteArtifactsFolder, getClusterName(configuration))
+		if cleaned[clusterFolder] {
+			continue
+		}
+		if !isSubfolder(absoluteArtifactsFolder, clusterFolder) {
+			return fmt.Errorf("the cluster %s of the service %s is not a folder name", getClusterName(configuration), configuration.ServiceName)
+		}
+		if err := os.RemoveAll(clusterFolder); err != nil {
+			return err
+		}
+		cleaned[clusterFolder] = true
+	}
+	return nil
+}
+
+// isSubfolder returns true when folder is inside, and not the same as, parent. Both paths must be absolute.
+func isSubfolder(parent string, folder string) bool {
+	relativePath, err := filepath.Rel(parent, folder)
+	return err == nil && relativePath != "." && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
 }
 
-func cleanArtifactFolders() {
+// digestcache maps a servicename to the last image built and pushed for the service.
+type digestcache map[string]digestCacheEntry
 
+type digestCacheEntry struct {
+	Hash    string `json:"hash"`
+	ImageID string `json:"imageid"`
+	Image   string `json:"image"`
+	Digest  string `json:"digest"`
 }
 
-type digestcache map[string]string
+// digestCacheLock guards the digestcache while services are built in parallel.
+var digestCacheLock sync.Mutex
+
+func (cache digestcache) get(serviceName string) (digestCacheEntry, bool) {
+	digestCacheLock.Lock()
+	defer digestCacheLock.Unlock()
+	entry, found := cache[serviceName]
+	return entry, found
+}
+
+func (cache digestcache) set(serviceName string, entry digestCacheEntry) {
+	digestCacheLock.Lock()
+	defer digestCacheLock.Unlock()
+	cache[serviceName] = entry
+}
 
 func getDigestCache(path string) digestcache {
 	file, err := os.Open(path)
@@ -137,56 +299,205 @@ func getRegistryAuthString(username string, password string, dockerregistry stri
 }
 
 func findYT3ConfigurationFiles(sourceDirectory string) ([]structs.ConfigurationWithProjectPath, error) {
-	configName := "ytbdsettings.json"
 	var configs []structs.ConfigurationWithProjectPath
+	errs := configErrors{}
+	configFileInFolder := map[string]string{}
 
 	err := filepath.Walk(sourceDirectory, func(path string, info os.FileInfo, e error) error {
 		if e != nil {
 			return e
 		}
 
-		if info.IsDir() {
-			for _, folderToSkip := range foldersToSkip {
-				if folderToSkip == info.Name() {
-					return filepath.SkipDir
-				}
-			}
+		if info.IsDir() && isSkippedFolder(path) {
+			return filepath.SkipDir
 		}
 
-		if !info.Mode().IsRegular() || info.Name() != configName {
+		if !info.Mode().IsRegular() || !isConfigFileName(info.Name()) {
 			return nil
 		}
 
 		// log.Printf("Found configuration file at path: %v", path)
 
-		fileContent, err := ioutil.ReadFile(path)
-		if err != nil {
-			log.Println(err)
+		folder := filepath.Dir(path)
+		if otherConfigFile, found := configFileInFolder[folder]; found {
+			errs = append(errs, fmt.Errorf("found both %s and %s. Remove one of them", otherConfigFile, path))
 			return nil
 		}
+		configFileInFolder[folder] = path
 
-		configuration := structs.Configuration{}
-		deserializeError := json.Unmarshal(fileContent, &configuration)
+		node, err := readResolvedConfigFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
 
+		configuration, deserializeError := decodeConfiguration(node)
 		if deserializeError != nil {
-			log.Println(deserializeError)
+			if validationErrs := validateConfigurationNode(path, node); len(validationErrs) > 0 {
+				errs = append(errs, validationErrs...)
+			} else {
+				errs = append(errs, fmt.Errorf("%s: %v", path, deserializeError))
+			}
 			return nil
 		}
 
 		configs = append(configs, structs.ConfigurationWithProjectPath{
-			Configuration: configuration,
-			ProjectPath:   filepath.Dir(path),
+			Configuration:  configuration,
+			ProjectPath:    filepath.Dir(path),
+			ConfigFilePath: path,
 		})
 		return nil
 	})
 
-	return configs, err
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return configs, nil
 }
 
-func buildAndPushImages(ctx context.Context, configurations []structs.ConfigurationWithProjectPath, auth string) {
-	for _, configuration := range configurations {
-		buildDockerImage(ctx, configuration)
+// buildAndPushImages builds and pushes the services using a pool of parallel workers.
+// The results are returned in the same order as the configurations.
+func buildAndPushImages(ctx context.Context, cli client.ImageAPIClient, configurations []structs.ConfigurationWithProjectPath, digestCache digestcache, settings buildSettings) []buildResult {
+	results := make([]buildResult, len(configurations))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < settings.Parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = buildAndDeployService(ctx, cli, configurations[index], digestCache, settings)
+			}
+		}()
+	}
+
+	for index := range configurations {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func getServiceLogger(serviceName string) *log.Logger {
+	return log.New(log.Writer(), fmt.Sprintf("[%s] ", serviceName), log.Flags()|log.Lmsgprefix)
+}
+
+func buildAndDeployService(ctx context.Context, cli client.ImageAPIClient, configuration structs.ConfigurationWithProjectPath, digestCache digestcache, settings buildSettings) buildResult {
+	logger := getServiceLogger(configuration.ServiceName)
+	result := buildAndPushImage(ctx, logger, cli, configuration, digestCache, settings)
+
+	if result.Err != nil || (result.Skipped && result.Digest == "") {
+		return result
+	}
+
+	image := getPinnedImageReference(result.Image, result.Digest)
+	if err := copyDeloymentArtifactsToOutputFolder(logger, configuration, settings.ArtifactsFolder, settings.Namespace, image); err != nil {
+		result.Err = newServiceError(configuration, phaseDeploy, err)
+	}
+	return result
+}
+
+func buildAndPushImage(ctx context.Context, logger *log.Logger, cli client.ImageAPIClient, configuration structs.ConfigurationWithProjectPath, digestCache digestcache, settings buildSettings) buildResult {
+	result := buildResult{
+		ServiceName: configuration.ServiceName,
+		Cluster:     getClusterName(configuration),
+		Image:       getImageName(settings.Registry, configuration.ServiceName, settings.Tag),
+	}
+
+	arguments, err := builder.Manager.GetBuildArgumentsForProject(configuration)
+	if err != nil {
+		result.Err = newServiceError(configuration, phaseBuilder, err)
+		return result
+	}
+
+	if arguments == nil {
+		result.Skipped = true
+		return result
+	}
+	defer arguments.Cleanup()
+
+	contextHash, err := getContextHash(ctx, logger, arguments)
+	if err != nil {
+		result.Err = newServiceError(configuration, phaseContext, err)
+		return result
+	}
+	serviceHash := getServiceHash(configuration, arguments, contextHash)
+
+	if cached, found := digestCache.get(configuration.ServiceName); found && cached.Hash == serviceHash {
+		if cached.Image == result.Image && cached.Digest != "" {
+			logger.Printf("Service is unchanged since image %s was pushed. Skipping", result.Image)
+			result.Digest = cached.Digest
+			result.Skipped = true
+			return result
+		}
+
+		digest, retagErr := retagAndPushImage(ctx, logger, cli, cached, result.Image, settings.Auth)
+		if retagErr == nil {
+			cached.Image = result.Image
+			cached.Digest = digest
+			digestCache.set(configuration.ServiceName, cached)
+			result.Digest = digest
+			return result
+		}
+		logger.Printf("Unable to reuse image %s, rebuilding. %v", cached.ImageID, retagErr)
+	}
+
+	id, err := buildDockerImage(ctx, logger, cli, configuration, arguments, contextHash)
+	if err != nil {
+		result.Err = newServiceError(configuration, phaseBuild, err)
+		return result
+	}
+
+	logger.Printf("Tagging image %s as %s", id, result.Image)
+	if err := cli.ImageTag(ctx, id, result.Image); err != nil {
+		result.Err = newServiceError(configuration, phasePush, err)
+		return result
+	}
+
+	digest, err := pushImage(ctx, logger, cli, result.Image, settings.Auth)
+	if err != nil {
+		result.Err = newServiceError(configuration, phasePush, err)
+		return result
+	}
+	logger.Printf("Pushed image %s with digest %s", result.Image, digest)
+
+	digestCache.set(configuration.ServiceName, digestCacheEntry{
+		Hash:    serviceHash,
+		ImageID: id,
+		Image:   result.Image,
+		Digest:  digest,
+	})
+	result.Digest = digest
+	return result
+}
+
+// retagAndPushImage pushes an already built image of an unchanged service under a new image name.
+func retagAndPushImage(ctx context.Context, logger *log.Logger, cli client.ImageAPIClient, cached digestCacheEntry, imageName string, auth string) (string, error) {
+	logger.Printf("Service is unchanged. Retagging image %s as %s", cached.ImageID, imageName)
+	if err := cli.ImageTag(ctx, cached.ImageID, imageName); err != nil {
+		return "", err
+	}
+
+	digest, err := pushImage(ctx, logger, cli, imageName, auth)
+	if err != nil {
+		return "", err
 	}
+	logger.Printf("Pushed image %s with digest %s", imageName, digest)
+	return digest, nil
+}
+
+func getImageName(registry string, serviceName string, tag string) string {
+	repository := serviceName
+	if registry != "" {
+		repository = strings.TrimSuffix(registry, "/") + "/" + serviceName
+	}
+	return repository + ":" + tag
 }
 
 func getHexHashForContent(content string) string {
@@ -194,20 +505,31 @@ func getHexHashForContent(content string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func getHexForFolder(folderPath string) string {
-	// git log -n1 --pretty=format:"%h" --follow "."
-	hasher := md5.New()
-	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+// walkContextPath calls walkFn for every file of the context path with the name the file has inside the build context.
+// The skipped folders and the tool outputs are left out.
+func walkContextPath(source string, inContext string, walkFn func(path string, nameInContext string, info os.FileInfo) error) error {
+	stat, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return walkFn(source, filepath.ToSlash(inContext), stat)
+	}
+
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if info.IsDir() {
-			for _, folderToSkip := range foldersToSkip {
-				if folderToSkip == info.Name() {
-					return filepath.SkipDir
-				}
+		if info.IsDir() && isSkippedFolder(path) {
+			return filepath.SkipDir
+		}
+
+		if isToolOutputPath(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
 		if info.IsDir() {
@@ -218,22 +540,39 @@ func getHexForFolder(folderPath string) string {
 			return nil
 		}
 
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		return walkFn(path, filepath.ToSlash(filepath.Join(inContext, relativePath)), info)
+	})
+}
+
+func getHexForFolder(folderPath string, inContext string) (string, error) {
+	// git log -n1 --pretty=format:"%h" --follow "."
+	hasher := md5.New()
+	err := walkContextPath(folderPath, inContext, func(path string, nameInContext string, info os.FileInfo) error {
+		// The name, mode and size are part of the hash, so renaming or moving a file changes it.
+		fmt.Fprintf(hasher, "%s\x00%s\x00%d\x00", nameInContext, info.Mode(), info.Size())
+
 		reader, err := os.Open(path)
 
 		if err != nil {
 			return err
 		}
-		io.Copy(hasher, reader)
-		return nil
+		defer reader.Close()
+		_, err = io.Copy(hasher, reader)
+		return err
 	})
 
 	if err != nil {
-		log.Fatalln(err)
+		return "", err
 	}
-	return fmt.Sprintf("%x", hasher.Sum(nil))
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
-func getContextFilePath(ctx context.Context, buildArguments *builder.BuildArguments, contextFolder string) (string, error) {
+// getContextHash returns the combined hash of every path that is part of the docker build context.
+func getContextHash(ctx context.Context, logger *log.Logger, buildArguments *builder.BuildArguments) (string, error) {
 
 	contextPaths := make([]string, 0, len(buildArguments.DockerBuildContextPaths))
 	for k := range buildArguments.DockerBuildContextPaths {
@@ -244,28 +583,45 @@ func getContextFilePath(ctx context.Context, buildArguments *builder.BuildArgume
 	hashes := []string{}
 
 	for _, item := range contextPaths {
-		log.Printf("Fetching hash for folder %s", item)
+		logger.Printf("Fetching hash for folder %s", item)
 		start := time.Now()
 
 		// git log -n1 --pretty=format:"%h" --follow "."
-		hash := getHexForFolder(item)
+		hash, err := getHexForFolder(item, buildArguments.DockerBuildContextPaths[item])
+		if err != nil {
+			return "", err
+		}
 		hashes = append(hashes, hash)
 		elapsed := time.Now().Sub(start)
-		log.Printf("Hash for folder %s is %s. It took %s", item, hash, elapsed)
+		logger.Printf("Hash for folder %s is %s. It took %s", item, hash, elapsed)
 	}
 
-	file := filepath.Join(contextFolder, strings.Join(hashes, "-")+".tar")
-	return file, nil
+	// The hashes are combined into one, as the hash names the context tar file and a build may have many context paths.
+	if len(hashes) == 1 {
+		return hashes[0], nil
+	}
+	return getHexHashForContent(strings.Join(hashes, "-")), nil
 }
 
-func createOrReadDockerContext(ctx context.Context, configuration structs.ConfigurationWithProjectPath, buildArguments *builder.BuildArguments, contextFolder string) (*os.File, error) {
+func getContextFilePath(contextHash string, contextFolder string) string {
+	return filepath.Join(contextFolder, contextHash+".tar")
+}
 
-	contextPath, err := getContextFilePath(ctx, buildArguments, contextFolder)
+// getServiceHash returns the hash used to decide if a service has changed since it was last built.
+// A manual Dockerfile is part of the build context, so only generated Dockerfiles are added explicitly.
+func getServiceHash(configuration structs.ConfigurationWithProjectPath, buildArguments *builder.BuildArguments, contextHash string) string {
+	return getHexHashForContent(strings.Join([]string{
+		contextHash,
+		string(configuration.Builder),
+		buildArguments.DockerFileContent,
+	}, "\n"))
+}
 
-	log.Printf("Context path is %s", contextPath)
-	if err != nil {
-		return nil, err
-	}
+func createOrReadDockerContext(ctx context.Context, logger *log.Logger, configuration structs.ConfigurationWithProjectPath, buildArguments *builder.BuildArguments, contextHash string, contextFolder string) (*os.File, error) {
+
+	contextPath := getContextFilePath(contextHash, contextFolder)
+
+	logger.Printf("Context path is %s", contextPath)
 
 	reader, err := os.Open(contextPath)
 
@@ -274,54 +630,54 @@ func createOrReadDockerContext(ctx context.Context, configuration structs.Config
 			return nil, err
 		}
 
-		log.Printf("Creating tar file at path %s", contextPath)
+		logger.Printf("Creating tar file at path %s", contextPath)
 		start := time.Now()
-		// TODO: Create a tmp file, then rename instead...
-		tarError := tarDirectories(buildArguments.DockerBuildContextPaths, contextPath)
 
-		log.Printf("Created tar file in %s", time.Now().Sub(start))
+		// Services with the same context may be built in parallel, so the tar file is
+		// written to a temporary file that is renamed once it is complete.
+		tmpFile, err := ioutil.TempFile(contextFolder, "*.tar.tmp")
+		if err != nil {
+			return nil, err
+		}
+		tmpFile.Close()
+
+		tarError := tarDirectories(buildArguments.DockerBuildContextPaths, buildArguments.TemporaryPaths, tmpFile.Name())
+
+		logger.Printf("Created tar file in %s", time.Now().Sub(start))
 		if tarError != nil {
+			os.Remove(tmpFile.Name())
 			return nil, tarError
 		}
 
-		reader, err := os.Open(contextPath)
-		return reader, err
+		if err := os.Rename(tmpFile.Name(), contextPath); err != nil {
+			os.Remove(tmpFile.Name())
+			return nil, err
+		}
+
+		return os.Open(contextPath)
 	}
 	return reader, nil
 }
 
-func buildDockerImage(ctx context.Context, configuration structs.ConfigurationWithProjectPath) {
+// buildDockerImage builds the image for the service and returns its id.
+// Errors are returned as a *serviceError in either the context or the build phase.
+func buildDockerImage(ctx context.Context, logger *log.Logger, cli client.ImageAPIClient, configuration structs.ConfigurationWithProjectPath, arguments *builder.BuildArguments, contextHash string) (string, error) {
 	os.Setenv("DOCKER_BUILDKIT", "1")
 	os.Setenv("BUILDKIT_PROGRESS", "plain")
-	log.Printf("Building project %s", configuration.ServiceName)
+	logger.Printf("Building project %s", configuration.ServiceName)
 	contextFolder := path.Join(tmpFolder, "contexts")
 
 	mkcontextdirError := os.MkdirAll(contextFolder, 0755)
 	if mkcontextdirError != nil {
-		log.Fatalln(mkcontextdirError)
+		return "", newServiceError(configuration, phaseContext, mkcontextdirError)
 	}
 
-	arguments, err := builder.Manager.GetBuildArgumentsForProject(configuration)
+	reader, err := createOrReadDockerContext(ctx, logger, configuration, arguments, contextHash, contextFolder)
 	if err != nil {
-		log.Fatalln(err)
+		return "", newServiceError(configuration, phaseContext, err)
 	}
-
-	if arguments == nil {
-		return
-	}
-
-	reader, err := createOrReadDockerContext(ctx, configuration, arguments, contextFolder)
 	defer reader.Close()
 
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Fatalln(err)
-	}
-
 	buildOptions := types.ImageBuildOptions{
 		Tags: []string{configuration.ServiceName},
 	}
@@ -333,17 +689,17 @@ func buildDockerImage(ctx context.Context, configuration structs.ConfigurationWi
 	imageBuildResponse, err := cli.ImageBuild(ctx, reader, buildOptions)
 
 	if err != nil {
-		log.Fatalln(err)
+		return "", newServiceError(configuration, phaseBuild, err)
 	}
 
-	id, err := handleDockerBuildResponse(imageBuildResponse.Body)
+	id, err := handleDockerBuildResponse(logger, imageBuildResponse.Body)
 
 	if err != nil {
-		log.Fatal(err)
+		return "", newServiceError(configuration, phaseBuild, err)
 	}
 
-	log.Printf("Id of dockerimage: %s", id)
-
+	logger.Printf("Id of dockerimage: %s", id)
+	return id, nil
 }
 
 func addFileinfoToTarArchive(tarball *tar.Writer, filePath string, info os.FileInfo, pathInTar string) error {
@@ -372,19 +728,34 @@ type dockerMessage struct {
 	ErrorDetail struct {
 		Message string
 	}
-	Status   string `json:"status"`
-	Progress string `json:"progress"`
-	Aux      struct {
-		ID string `json:"ID"`
-	} `json:"aux"`
+	Status   string           `json:"status"`
+	Progress string           `json:"progress"`
+	Aux      dockerMessageAux `json:"aux"`
+}
+
+type dockerMessageAux struct {
+	ID     string `json:"ID"`
+	Digest string `json:"Digest"`
+}
+
+func handleDockerBuildResponse(logger *log.Logger, resp io.ReadCloser) (string, error) {
+	aux, err := handleDockerResponse(logger, resp)
+	return aux.ID, err
+}
+
+func handleDockerPushResponse(logger *log.Logger, resp io.ReadCloser) (string, error) {
+	aux, err := handleDockerResponse(logger, resp)
+	return aux.Digest, err
 }
 
-func handleDockerBuildResponse(resp io.ReadCloser) (string, error) {
+// handleDockerResponse reads the json message stream returned by the docker daemon
+// and returns the aux values reported in it, or the first error reported.
+func handleDockerResponse(logger *log.Logger, resp io.ReadCloser) (dockerMessageAux, error) {
 	defer resp.Close()
 
 	scanner := bufio.NewScanner(resp)
 	msg := dockerMessage{}
-	id := ""
+	aux := dockerMessageAux{}
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		msg.ID = ""
@@ -392,14 +763,20 @@ func handleDockerBuildResponse(resp io.ReadCloser) (string, error) {
 		msg.Error = ""
 		msg.ErrorDetail.Message = ""
 		msg.Aux.ID = ""
+		msg.Aux.Digest = ""
 		msg.Status = ""
 		msg.Progress = ""
 		if err := json.Unmarshal(line, &msg); err == nil {
 			if msg.Error != "" {
-				return id, fmt.Errorf("%s", msg.Error)
+				return aux, fmt.Errorf("%s", msg.Error)
 			}
-			if msg.Aux.ID != "" {
-				id = msg.Aux.ID
+			if msg.Aux.ID != "" || msg.Aux.Digest != "" {
+				if msg.Aux.ID != "" {
+					aux.ID = msg.Aux.ID
+				}
+				if msg.Aux.Digest != "" {
+					aux.Digest = msg.Aux.Digest
+				}
 			} else if msg.Status != "" {
 				if msg.Progress != "" {
 					//log.Printf("  %s :: %s :: %s\n", msg.Status, msg.ID, msg.Progress)
@@ -412,11 +789,11 @@ func handleDockerBuildResponse(resp io.ReadCloser) (string, error) {
 				//log.Printf("Unable to handle line: %s", string(line))
 			}
 		} else {
-			log.Printf("Unable to unmarshal line [%s] ==> %v", string(line), err)
+			logger.Printf("Unable to unmarshal line [%s] ==> %v", string(line), err)
 		}
 	}
 
-	return id, nil
+	return aux, scanner.Err()
 }
 
 func addPathToTarArchive(tarball *tar.Writer, filePath string, pathInTar string) error {
@@ -428,65 +805,69 @@ func addPathToTarArchive(tarball *tar.Writer, filePath string, pathInTar string)
 	return nil
 }
 
-func tarDirectories(sources map[string]string, target string) error {
-	tarfile, err := os.Create(target)
-	if err != nil {
-		return err
-	}
-	defer tarfile.Close()
-
-	tarball := tar.NewWriter(tarfile)
-	defer tarball.Close()
-
-	for source, inContext := range sources {
-
-		stat, err := os.Stat(source)
+type contextFile struct {
+	path string
+	info os.FileInfo
+}
 
-		if !stat.IsDir() {
-			addFileinfoToTarArchive(tarball, source, stat, inContext)
-			continue
+// tarDirectories writes the sources to the tar file at the paths they map to inside the build context.
+// Files of the temporary paths replace the files with the same name from the other sources,
+// so a generated Dockerfile is used over a Dockerfile in the working directory.
+func tarDirectories(sources map[string]string, temporaryPaths []string, target string) error {
+	orderedSources := []string{}
+	orderedTemporaryPaths := []string{}
+	for source := range sources {
+		if containsString(temporaryPaths, source) {
+			orderedTemporaryPaths = append(orderedTemporaryPaths, source)
+		} else {
+			orderedSources = append(orderedSources, source)
 		}
+	}
+	sort.Strings(orderedSources)
+	sort.Strings(orderedTemporaryPaths)
+
+	files := map[string]contextFile{}
+	for _, source := range append(orderedSources, orderedTemporaryPaths...) {
+		err := walkContextPath(source, sources[source], func(path string, nameInContext string, info os.FileInfo) error {
+			files[nameInContext] = contextFile{path: path, info: info}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
+	}
 
-		err = filepath.Walk(source,
-			func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-
-				if info.IsDir() {
-					for _, folderToSkip := range foldersToSkip {
-						if folderToSkip == info.Name() {
-							return filepath.SkipDir
-						}
-					}
-				}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-				if info.IsDir() {
-					return nil
-				}
+	tarfile, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer tarfile.Close()
 
-				if !info.Mode().IsRegular() {
-					return nil
-				}
+	tarball := tar.NewWriter(tarfile)
+	defer tarball.Close()
 
-				filepathInTar := strings.TrimPrefix(path, source)
-				return addFileinfoToTarArchive(tarball, path, info, filepathInTar)
-			})
-		if err != nil {
+	for _, name := range names {
+		if err := addFileinfoToTarArchive(tarball, files[name].path, files[name].info, name); err != nil {
 			return err
 		}
 	}
 	return nil
-
 }
 
-func pushImage() {
-
-}
-
-func copyDeloymentArtifactsToOutputFolder() {
+func pushImage(ctx context.Context, logger *log.Logger, cli client.ImageAPIClient, imageName string, auth string) (string, error) {
+	logger.Printf("Pushing image %s", imageName)
+	pushResponse, err := cli.ImagePush(ctx, imageName, types.ImagePushOptions{
+		RegistryAuth: auth,
+	})
+	if err != nil {
+		return "", err
+	}
 
+	return handleDockerPushResponse(logger, pushResponse)
 }
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// fakeImageClient records the calls made to the docker daemon and replies with the configured message streams.
+type fakeImageClient struct {
+	client.ImageAPIClient
+
+	buildStream string
+	pushStream  string
+	pushErr     error
+
+	builds    int
+	tags      [][2]string
+	pushes    []string
+	pushAuths []string
+}
+
+func (c *fakeImageClient) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	c.builds++
+	return types.ImageBuildResponse{Body: ioutil.NopCloser(strings.NewReader(c.buildStream))}, nil
+}
+
+func (c *fakeImageClient) ImageTag(ctx context.Context, image string, ref string) error {
+	c.tags = append(c.tags, [2]string{image, ref})
+	return nil
+}
+
+func (c *fakeImageClient) ImagePush(ctx context.Context, ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+	c.pushes = append(c.pushes, ref)
+	c.pushAuths = append(c.pushAuths, options.RegistryAuth)
+	if c.pushErr != nil {
+		return nil, c.pushErr
+	}
+	return ioutil.NopCloser(strings.NewReader(c.pushStream)), nil
+}
+
+const testBuildStream = `{"stream":"Step 1/1 : FROM scratch"}
+{"aux":{"ID":"sha256:1d"}}
+`
+
+const testPushStream = `{"status":"Pushed","id":"4f"}
+{"status":"1: digest: sha256:d1 size: 528"}
+{"progressDetail":{},"aux":{"Tag":"1","Digest":"sha256:d1","Size":528}}
+`
+
+// chdirToTempDir makes a new temporary folder the working directory for the rest of the test.
+func chdirToTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "docker-builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func writeTestFile(t *testing.T, file string, content string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupManualService creates a working directory with a service built from its own Dockerfile.
+func setupManualService(t *testing.T) structs.ConfigurationWithProjectPath {
+	chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("api", "Dockerfile"), "FROM scratch\n")
+
+	return structs.ConfigurationWithProjectPath{
+		Configuration: structs.Configuration{
+			ServiceName: "api",
+			Builder:     json.RawMessage(`{"type":"manual","buildcontext":"projectdir"}`),
+		},
+		ProjectPath: "api",
+	}
+}
+
+func getTestSettings() buildSettings {
+	return buildSettings{
+		Registry: "registry.example.com/",
+		Tag:      "1",
+		Auth:     "c2VjcmV0",
+		Parallel: 1,
+	}
+}
+
+func TestBuildAndPushImageTagsAndPushesTheImage(t *testing.T) {
+	configuration := setupManualService(t)
+	cli := &fakeImageClient{buildStream: testBuildStream, pushStream: testPushStream}
+	cache := digestcache{}
+
+	result := buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+
+	if result.Err != nil {
+		t.Fatalf("expected the service to be built, got %v", result.Err)
+	}
+	if result.Image != "registry.example.com/api:1" {
+		t.Errorf("expected the image registry.example.com/api:1, got %s", result.Image)
+	}
+	if len(cli.tags) != 1 || cli.tags[0] != [2]string{"sha256:1d", "registry.example.com/api:1"} {
+		t.Errorf("expected the built image to be tagged with the image name, got %v", cli.tags)
+	}
+	if len(cli.pushes) != 1 || cli.pushes[0] != "registry.example.com/api:1" {
+		t.Errorf("expected the image to be pushed once, got %v", cli.pushes)
+	}
+	if cli.pushAuths[0] != "c2VjcmV0" {
+		t.Errorf("expected the push to use the registry auth, got %q", cli.pushAuths[0])
+	}
+	if result.Digest != "sha256:d1" {
+		t.Errorf("expected the digest from the push stream, got %q", result.Digest)
+	}
+
+	cached, found := cache.get("api")
+	if !found || cached.ImageID != "sha256:1d" || cached.Digest != "sha256:d1" || cached.Image != result.Image {
+		t.Errorf("expected the pushed image to be cached, got %+v", cached)
+	}
+}
+
+func TestBuildAndPushImageSkipsUnchangedServices(t *testing.T) {
+	configuration := setupManualService(t)
+	cli := &fakeImageClient{buildStream: testBuildStream, pushStream: testPushStream}
+	cache := digestcache{}
+
+	buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+	result := buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+
+	if !result.Skipped || result.Digest != "sha256:d1" {
+		t.Errorf("expected the unchanged service to be skipped with the cached digest, got %+v", result)
+	}
+	if cli.builds != 1 || len(cli.pushes) != 1 {
+		t.Errorf("expected a single build and push, got %d builds and %d pushes", cli.builds, len(cli.pushes))
+	}
+}
+
+func TestBuildAndPushImageFailsWhenThePushFails(t *testing.T) {
+	tests := map[string]*fakeImageClient{
+		"push request fails": {buildStream: testBuildStream, pushErr: errors.New("connection refused")},
+		"push stream errors": {buildStream: testBuildStream, pushStream: `{"status":"Preparing"}
+{"errorDetail":{"message":"denied: requested access to the resource is denied"},"error":"denied: requested access to the resource is denied"}
+`},
+	}
+
+	for name, cli := range tests {
+		t.Run(name, func(t *testing.T) {
+			configuration := setupManualService(t)
+			cache := digestcache{}
+
+			result := buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+
+			if result.Err == nil {
+				t.Fatal("expected the service to fail")
+			}
+			if result.Err.Phase != phasePush {
+				t.Errorf("expected the push phase to fail, got %s", result.Err.Phase)
+			}
+			if result.Digest != "" {
+				t.Errorf("expected no digest, got %s", result.Digest)
+			}
+			if _, found := cache.get("api"); found {
+				t.Error("expected the failed push not to be cached")
+			}
+		})
+	}
+}
+
+func TestCleanArtifactFoldersRemovesTheClustersBeingBuilt(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("artifacts", "services", "removed.yaml"), "kind: Deployment\n")
+	writeTestFile(t, filepath.Join("artifacts", "controller", "operator.yaml"), "kind: Deployment\n")
+	writeTestFile(t, filepath.Join("api", "Dockerfile"), "FROM scratch\n")
+
+	configurations := []structs.ConfigurationWithProjectPath{
+		{Configuration: structs.Configuration{ServiceName: "api", Cluster: "services"}, ProjectPath: "api"},
+	}
+	if err := cleanArtifactFolders("artifacts", configurations); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join("artifacts", "services")); !os.IsNotExist(err) {
+		t.Errorf("expected the services artifacts to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("artifacts", "controller", "operator.yaml")); err != nil {
+		t.Errorf("expected the controller artifacts to be kept, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("api", "Dockerfile")); err != nil {
+		t.Errorf("expected the working directory to be kept, got %v", err)
+	}
+}
+
+func TestCleanArtifactFoldersRefusesFoldersOutsideTheWorkingDirectory(t *testing.T) {
+	dir := chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("api", "Dockerfile"), "FROM scratch\n")
+	configurations := []structs.ConfigurationWithProjectPath{
+		{Configuration: structs.Configuration{ServiceName: "api"}, ProjectPath: "api"},
+		{Configuration: structs.Configuration{ServiceName: "escape", Cluster: ".."}, ProjectPath: "api"},
+	}
+
+	for _, artifactsFolder := range []string{".", "..", "api/..", dir, filepath.Dir(dir)} {
+		if err := cleanArtifactFolders(artifactsFolder, configurations[:1]); err == nil {
+			t.Errorf("expected the artifacts folder %s to be refused", artifactsFolder)
+		}
+	}
+	if err := cleanArtifactFolders("artifacts", configurations); err == nil {
+		t.Error("expected the cluster .. to be refused")
+	}
+	if _, err := os.Stat(filepath.Join("api", "Dockerfile")); err != nil {
+		t.Errorf("expected the working directory to be kept, got %v", err)
+	}
+}
+
+func TestBuildAndPushImageRebuildsRenamedFiles(t *testing.T) {
+	configuration := setupManualService(t)
+	writeTestFile(t, filepath.Join("api", "index.html"), "<h1>api</h1>\n")
+	cli := &fakeImageClient{buildStream: testBuildStream, pushStream: testPushStream}
+	cache := digestcache{}
+
+	buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+	if err := os.Rename(filepath.Join("api", "index.html"), filepath.Join("api", "home.html")); err != nil {
+		t.Fatal(err)
+	}
+	result := buildAndPushImage(context.Background(), log.New(ioutil.Discard, "", 0), cli, configuration, cache, getTestSettings())
+
+	if result.Skipped || cli.builds != 2 {
+		t.Errorf("expected the renamed file to rebuild the service, got %d builds", cli.builds)
+	}
+}
+
+func getTarNames(t *testing.T, file string) []string {
+	reader, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	names := []string{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTarDirectoriesKeepsThePathsInTheContext(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, "package.json", "{}\n")
+	writeTestFile(t, ".yarnrc.yml", "nodeLinker: pnp\n")
+	writeTestFile(t, ".pnp.cjs", "\n")
+	writeTestFile(t, filepath.Join(".yarn", "releases", "yarn.cjs"), "\n")
+	writeTestFile(t, filepath.Join("lib", "index.js"), "\n")
+	writeTestFile(t, filepath.Join("node_modules", "core", "index.js"), "\n")
+
+	tests := []struct {
+		name     string
+		sources  map[string]string
+		expected []string
+	}{
+		{
+			name:     "root context",
+			sources:  map[string]string{".": ""},
+			expected: []string{".pnp.cjs", ".yarn/releases/yarn.cjs", ".yarnrc.yml", "lib/index.js", "package.json"},
+		},
+		{
+			name:     "folder moved in the context",
+			sources:  map[string]string{"lib": "vendor/lib", ".yarnrc.yml": ".yarnrc.yml"},
+			expected: []string{".yarnrc.yml", "vendor/lib/index.js"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "context.tar")
+			if err := tarDirectories(test.sources, nil, target); err != nil {
+				t.Fatal(err)
+			}
+			if names := getTarNames(t, target); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected the context %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestTarDirectoriesUsesTheGeneratedDockerfile(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, "Dockerfile", "FROM nginx\n")
+	writeTestFile(t, filepath.Join("generated", "Dockerfile"), "FROM scratch\n")
+
+	target := filepath.Join(t.TempDir(), "context.tar")
+	if err := tarDirectories(map[string]string{".": "", "generated": ""}, []string{"generated"}, target); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	tarReader := tar.NewReader(reader)
+	dockerfiles := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == "Dockerfile" {
+			content, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dockerfiles = append(dockerfiles, string(content))
+		}
+	}
+	if !reflect.DeepEqual(dockerfiles, []string{"FROM scratch\n"}) {
+		t.Errorf("expected only the generated Dockerfile in the context, got %q", dockerfiles)
+	}
+}
+
+func TestTarDirectoriesSkipsOnlyTheDotnetBinFolders(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("api", "Api.csproj"), "<Project />\n")
+	writeTestFile(t, filepath.Join("api", "bin", "Debug", "Api.dll"), "\n")
+	writeTestFile(t, filepath.Join("cli", "Cargo.toml"), "[package]\nname = \"cli\"\n")
+	writeTestFile(t, filepath.Join("cli", "src", "bin", "tool.rs"), "fn main() {}\n")
+
+	target := filepath.Join(t.TempDir(), "context.tar")
+	if err := tarDirectories(map[string]string{".": ""}, nil, target); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"api/Api.csproj", "cli/Cargo.toml", "cli/src/bin/tool.rs"}
+	if names := getTarNames(t, target); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the context %v, got %v", expected, names)
+	}
+}
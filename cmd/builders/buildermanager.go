@@ -5,45 +5,145 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/groenlid/docker-builder/cmd/structs"
 )
 
 type Builder struct {
-	BuilderNames      []string
+	BuilderNames []string
+	// Config is an empty configuration of the builder, describing the keys allowed in the builder section.
+	// Fields are tagged with required:"true" when they must be given, enum:"a,b" when only some values are allowed,
+	// and description:"..." to document them in the JSON Schema.
+	Config            interface{}
 	GetBuildArguments func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error)
 }
 
 type BuildArguments struct {
-	DockerBuildContextPaths map[string]string
-	DockerFilePath          string
+	// DockerBuildContextPaths maps the paths added to the build context to where they end up inside the context.
+	DockerBuildContextPaths map[string]string `json:"dockerbuildcontextpaths"`
+	DockerFilePath          string            `json:"dockerfilepath,omitempty"`
+	// DockerFileContent is the content of the Dockerfile when it is generated by the builder.
+	DockerFileContent string `json:"dockerfilecontent,omitempty"`
+	// SourcePaths are the paths whose content ends up in the image, when they are narrower than the build context.
+	SourcePaths []string `json:"sourcepaths,omitempty"`
+	// TemporaryPaths are created by the builder and removed by Cleanup.
+	TemporaryPaths []string `json:"-"`
+}
+
+// Cleanup removes the temporary files created by the builder, like generated Dockerfiles.
+func (a *BuildArguments) Cleanup() {
+	for _, temporaryPath := range a.TemporaryPaths {
+		if err := os.RemoveAll(temporaryPath); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// getContextPathsInPlace adds every path to the build context at the same path it has in the working directory.
+// Paths inside one of the other paths are already part of the context and left out.
+func getContextPathsInPlace(paths []string) map[string]string {
+	contextPaths := map[string]string{}
+	for _, item := range paths {
+		item = filepath.Clean(item)
+		isInsideOtherPath := false
+		for _, other := range paths {
+			relativePath, err := filepath.Rel(filepath.Clean(other), item)
+			if err == nil && relativePath != "." && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+				isInsideOtherPath = true
+			}
+		}
+		if isInsideOtherPath {
+			continue
+		}
+		if item == "." {
+			contextPaths[item] = ""
+		} else {
+			contextPaths[item] = filepath.ToSlash(item)
+		}
+	}
+	return contextPaths
 }
 
 type BuilderManager struct {
 	Builders []*Builder
 }
 
+// Register adds a builder to the manager. Every builder type can only be registered once.
+func (m *BuilderManager) Register(builder *Builder) error {
+	if builder.GetBuildArguments == nil {
+		return fmt.Errorf("the builder %v has no GetBuildArguments", builder.BuilderNames)
+	}
+	for _, builderName := range builder.BuilderNames {
+		if _, found := m.GetBuilder(builderName); found {
+			return fmt.Errorf("a builder of type %q is already registered", builderName)
+		}
+	}
+	m.Builders = append(m.Builders, builder)
+	return nil
+}
+
 func (m *BuilderManager) PrintBuilders() {
 	for _, builder := range m.Builders {
 		log.Println(builder.BuilderNames)
 	}
 }
 
-func (m *BuilderManager) GetBuildArgumentsForProject(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+// GetBuilderType returns the type given in the builder section of the configuration.
+func GetBuilderType(conf structs.ConfigurationWithProjectPath) (string, error) {
 	baseBuilder := &structs.BaseBuilder{}
+	if len(conf.Builder) == 0 {
+		return baseBuilder.Type, nil
+	}
 
 	err := json.Unmarshal(conf.Builder, &baseBuilder)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return baseBuilder.Type, nil
+}
 
+// GetBuilder returns the builder registered for the builder type.
+func (m *BuilderManager) GetBuilder(builderType string) (*Builder, bool) {
 	for _, builder := range m.Builders {
 		for _, builderName := range builder.BuilderNames {
-			if builderName == baseBuilder.Type {
-				return builder.GetBuildArguments(conf)
+			if builderName == builderType {
+				return builder, true
 			}
 		}
 	}
+	return nil, false
+}
+
+// GetBuilderTypes returns the names of every registered builder type.
+func (m *BuilderManager) GetBuilderTypes() []string {
+	builderTypes := []string{}
+	for _, builder := range m.Builders {
+		for _, builderName := range builder.BuilderNames {
+			if builderName != "" {
+				builderTypes = append(builderTypes, builderName)
+			}
+		}
+	}
+	return builderTypes
+}
+
+func (m *BuilderManager) GetBuildArgumentsForProject(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+	builderType, err := GetBuilderType(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// A service without a builder section uses the default builder.
+	if len(conf.Builder) == 0 {
+		conf.Builder = json.RawMessage("{}")
+	}
+
+	if builder, found := m.GetBuilder(builderType); found {
+		return builder.GetBuildArguments(conf)
+	}
 	return nil, errors.New(fmt.Sprintf("No builder found for service %s at path %s", conf.ServiceName, conf.ProjectPath))
 }
 
@@ -51,6 +151,11 @@ var Manager = &BuilderManager{
 	Builders: []*Builder{
 		NodeBuilder,
 		DotnetBuilder,
+		GoBuilder,
+		PythonBuilder,
+		StaticBuilder,
+		JvmBuilder,
+		RustBuilder,
 		ManualBuilder,
 	},
 }
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -16,20 +17,35 @@ import (
 
 type DotnetBuilderConfig struct {
 	Type          string `json:"type"`
-	DotnetRuntime string `json:"dotnetruntime"`
+	DotnetRuntime string `json:"dotnetruntime" enum:"runtime,aspnet" description:"The runtime image used by the service. Selected from the package references of the project when not given."`
+	ProjectFile   string `json:"projectfile" description:"The project file relative to the config file. Required when the folder contains multiple project files."`
 }
 
-func findProjectFileInPath(path string) (fs.FileInfo, error) {
+func findProjectFileInPath(path string, projectFile string) (fs.FileInfo, error) {
+	if projectFile != "" {
+		return os.Stat(filepath.Join(path, projectFile))
+	}
+
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
+
+	projectFiles := []fs.FileInfo{}
 	for _, file := range files {
-		if strings.Contains(file.Name(), ".csproj") {
-			return file, nil
+		// Files like Api.csproj.user hold settings of an editor and are not project files.
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".csproj" {
+			projectFiles = append(projectFiles, file)
 		}
 	}
 
+	if len(projectFiles) > 1 {
+		return nil, fmt.Errorf("found multiple project files in path %s. Set projectfile to choose one of them", path)
+	}
+	if len(projectFiles) == 1 {
+		return projectFiles[0], nil
+	}
+
 	return nil, fmt.Errorf("could not find project file in path %s", path)
 }
 
@@ -150,6 +166,7 @@ func getDotnetRuntime(builderConfig *DotnetBuilderConfig, projectfiles []string)
 
 var DotnetBuilder = &Builder{
 	BuilderNames: []string{"dotnet"},
+	Config:       DotnetBuilderConfig{},
 	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
 		builderConfig := &DotnetBuilderConfig{}
 		err := json.Unmarshal(conf.Builder, builderConfig)
@@ -157,7 +174,7 @@ var DotnetBuilder = &Builder{
 			return nil, err
 		}
 
-		projectFile, err := findProjectFileInPath(conf.ProjectPath)
+		projectFile, err := findProjectFileInPath(conf.ProjectPath, builderConfig.ProjectFile)
 		if err != nil {
 			return nil, err
 		}
@@ -173,7 +190,7 @@ var DotnetBuilder = &Builder{
 		copyProjectDependenciesProjectFiles := getDockerCopyCommandForDependency(projectDependencies)
 		projectDir := path.Join(DockerSrc, conf.ProjectPath)
 		copyProjectDependencies := getDockerCopyCommandForDependency(getDirOfPaths(projectDependencies))
-		projectName := strings.Replace(projectFile.Name(), ".csproj", "", 1)
+		projectName := strings.TrimSuffix(projectFile.Name(), ".csproj")
 		dockerRuntimeImage, err := getDotnetRuntime(builderConfig, projectDependencies)
 
 		if err != nil {
@@ -215,6 +232,9 @@ var DotnetBuilder = &Builder{
 		}
 
 		arguments := &BuildArguments{
+			DockerFileContent: dockercontent,
+			TemporaryPaths:    []string{tmpDir},
+			SourcePaths:       unique(getDirOfPaths(projectDependencies)),
 			DockerBuildContextPaths: map[string]string{
 				".":    "",
 				tmpDir: "",
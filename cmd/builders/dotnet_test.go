@@ -0,0 +1,18 @@
+package builder
+
+import "testing"
+
+func TestFindProjectFileInPathIgnoresUserFiles(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{
+		"Api.csproj":      "<Project />\n",
+		"Api.csproj.user": "<Project />\n",
+	})
+
+	projectFile, err := findProjectFileInPath(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectFile.Name() != "Api.csproj" {
+		t.Errorf("expected Api.csproj, got %s", projectFile.Name())
+	}
+}
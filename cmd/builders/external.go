@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// ExternalBuilderPrefix is the prefix of the executables providing a builder, followed by the builder type.
+const ExternalBuilderPrefix = "docker-builder-builder-"
+
+// NewExternalBuilder returns a builder running the executable to get the build arguments.
+// The executable gets the ConfigurationWithProjectPath as json on stdin, and writes the BuildArguments as json to stdout.
+// It runs in the working directory of docker-builder, so paths are relative to the same folder as the ProjectPath.
+func NewExternalBuilder(builderType string, executable string) *Builder {
+	return &Builder{
+		BuilderNames: []string{builderType},
+		GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+			input, err := json.Marshal(conf)
+			if err != nil {
+				return nil, err
+			}
+
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			command := exec.Command(executable)
+			command.Stdin = bytes.NewReader(input)
+			command.Stdout = stdout
+			command.Stderr = stderr
+			if err := command.Run(); err != nil {
+				return nil, fmt.Errorf("the builder %s failed: %v %s", executable, err, strings.TrimSpace(stderr.String()))
+			}
+
+			arguments := &BuildArguments{}
+			if err := json.Unmarshal(stdout.Bytes(), arguments); err != nil {
+				return nil, fmt.Errorf("the builder %s returned invalid build arguments: %v", executable, err)
+			}
+			if len(arguments.DockerBuildContextPaths) == 0 {
+				return nil, fmt.Errorf("the builder %s returned no dockerbuildcontextpaths", executable)
+			}
+
+			if arguments.DockerFileContent != "" && arguments.DockerFilePath == "" {
+				if err := writeGeneratedDockerfile(arguments); err != nil {
+					return nil, err
+				}
+			}
+			return arguments, nil
+		},
+	}
+}
+
+// writeGeneratedDockerfile writes the DockerFileContent to a temporary folder at the root of the build context.
+func writeGeneratedDockerfile(arguments *BuildArguments) error {
+	return writeGeneratedFiles(arguments, map[string]string{"Dockerfile": arguments.DockerFileContent})
+}
+
+// writeGeneratedFiles writes the files by name to a temporary folder at the root of the build context.
+func writeGeneratedFiles(arguments *BuildArguments, files map[string]string) error {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
+	arguments.TemporaryPaths = append(arguments.TemporaryPaths, tmpDir)
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0755); err != nil {
+			return err
+		}
+	}
+	arguments.DockerBuildContextPaths[tmpDir] = ""
+	return nil
+}
+
+// FindExternalBuilders returns the executables named docker-builder-builder-<type> in PATH by builder type.
+// When a type is found in several folders, the first one in PATH is used.
+func FindExternalBuilders() map[string]string {
+	executables := map[string]string{}
+	for _, folder := range filepath.SplitList(os.Getenv("PATH")) {
+		direntries, err := os.ReadDir(folder)
+		if err != nil {
+			continue
+		}
+		for _, direntry := range direntries {
+			name := direntry.Name()
+			if !strings.HasPrefix(name, ExternalBuilderPrefix) || direntry.IsDir() {
+				continue
+			}
+			builderType := strings.TrimSuffix(strings.TrimPrefix(name, ExternalBuilderPrefix), ".exe")
+			if _, found := executables[builderType]; found || builderType == "" {
+				continue
+			}
+			info, err := direntry.Info()
+			if err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			executables[builderType] = filepath.Join(folder, name)
+		}
+	}
+	return executables
+}
+
+// RegisterExternalBuilders registers the external builders found in PATH.
+// The registered builders take precedence, so an external builder can not replace them.
+func (m *BuilderManager) RegisterExternalBuilders() []error {
+	errs := []error{}
+	for builderType, executable := range FindExternalBuilders() {
+		if err := m.Register(NewExternalBuilder(builderType, executable)); err != nil {
+			errs = append(errs, fmt.Errorf("ignoring the external builder %s: %v", executable, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,146 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// writeExecutable writes a shell script to the folder, and returns its path.
+func writeExecutable(t *testing.T, dir string, name string, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping the external builder, as it is a shell script")
+	}
+	executable := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(executable, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return executable
+}
+
+var externalConfiguration = structs.ConfigurationWithProjectPath{
+	Configuration: structs.Configuration{
+		ServiceName: "api",
+		Builder:     json.RawMessage(`{"type":"custom","flavour":"plain"}`),
+	},
+	ProjectPath:    "services/api",
+	ConfigFilePath: "services/api/ytbdsettings.json",
+}
+
+func TestExternalBuilderProtocol(t *testing.T) {
+	tests := []struct {
+		name                string
+		stdout              string
+		generatesDockerfile bool
+	}{
+		{"generated Dockerfile", `{"dockerbuildcontextpaths":{"services/api":""},"dockerfilecontent":"FROM scratch"}`, true},
+		{"Dockerfile in the context", `{"dockerbuildcontextpaths":{"services/api":""},"dockerfilepath":"Dockerfile.custom"}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "input.json")
+			executable := writeExecutable(t, dir, "builder", "cat > '"+input+"'\necho '"+test.stdout+"'\n")
+
+			arguments, err := NewExternalBuilder("custom", executable).GetBuildArguments(externalConfiguration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer arguments.Cleanup()
+
+			given := structs.ConfigurationWithProjectPath{}
+			content, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(content, &given); err != nil {
+				t.Fatalf("expected the configuration as json on stdin, got %s: %v", content, err)
+			}
+			if given.ServiceName != "api" || given.ProjectPath != "services/api" || given.ConfigFilePath != "services/api/ytbdsettings.json" || string(given.Builder) != `{"type":"custom","flavour":"plain"}` {
+				t.Errorf("expected the configuration with its paths on stdin, got %s", content)
+			}
+
+			if inContext, found := arguments.DockerBuildContextPaths["services/api"]; !found || inContext != "" {
+				t.Errorf("expected the context paths of the builder, got %v", arguments.DockerBuildContextPaths)
+			}
+			if test.generatesDockerfile {
+				if len(arguments.TemporaryPaths) != 1 {
+					t.Fatalf("expected the generated Dockerfile in a temporary path, got %v", arguments.TemporaryPaths)
+				}
+				dockerfile, err := ioutil.ReadFile(filepath.Join(arguments.TemporaryPaths[0], "Dockerfile"))
+				if err != nil || string(dockerfile) != "FROM scratch" {
+					t.Errorf("expected the generated Dockerfile to be written, got %q %v", dockerfile, err)
+				}
+				if _, found := arguments.DockerBuildContextPaths[arguments.TemporaryPaths[0]]; !found {
+					t.Error("expected the generated Dockerfile to be part of the build context")
+				}
+			} else if len(arguments.TemporaryPaths) != 0 || arguments.DockerFilePath != "Dockerfile.custom" {
+				t.Errorf("expected the Dockerfile of the context to be used, got %+v", arguments)
+			}
+		})
+	}
+}
+
+func TestExternalBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		message string
+	}{
+		{"exits with an error", "echo 'unknown flavour' >&2\nexit 3\n", "exit status 3 unknown flavour"},
+		{"invalid json", "echo 'FROM scratch'\n", "returned invalid build arguments"},
+		{"no context paths", "echo '{\"dockerfilecontent\":\"FROM scratch\"}'\n", "returned no dockerbuildcontextpaths"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			executable := writeExecutable(t, t.TempDir(), "builder", "cat > /dev/null\n"+test.script)
+
+			_, err := NewExternalBuilder("custom", executable).GetBuildArguments(externalConfiguration)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error with %q, got %v", test.message, err)
+			}
+		})
+	}
+}
+
+func TestRegisterExternalBuilders(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeExecutable(t, first, ExternalBuilderPrefix+"custom", "exit 0\n")
+	writeExecutable(t, second, ExternalBuilderPrefix+"custom", "exit 0\n")
+	writeExecutable(t, first, ExternalBuilderPrefix+"nodejs", "exit 0\n")
+	if err := ioutil.WriteFile(filepath.Join(first, ExternalBuilderPrefix+"notexecutable"), []byte("exit 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previousPath := os.Getenv("PATH")
+	os.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator)))
+	t.Cleanup(func() { os.Setenv("PATH", previousPath) })
+
+	manager := &BuilderManager{Builders: []*Builder{NodeBuilder}}
+	errs := manager.RegisterExternalBuilders()
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), ExternalBuilderPrefix+"nodejs") {
+		t.Errorf("expected the external nodejs builder to be ignored, got %v", errs)
+	}
+	if builder, found := manager.GetBuilder("nodejs"); !found || builder != NodeBuilder {
+		t.Error("expected the nodejs builder to stay the built in one")
+	}
+	if _, found := manager.GetBuilder("notexecutable"); found {
+		t.Error("expected files that are not executable to be ignored")
+	}
+	if executable := FindExternalBuilders()["custom"]; executable != filepath.Join(first, ExternalBuilderPrefix+"custom") {
+		t.Errorf("expected the custom builder first in PATH, got %s", executable)
+	}
+	if _, found := manager.GetBuilder("custom"); !found {
+		t.Error("expected the custom builder to be registered")
+	}
+}
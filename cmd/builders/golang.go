@@ -0,0 +1,194 @@
+package builder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+type GoBuilderConfig struct {
+	Type      string `json:"type"`
+	GoVersion string `json:"goversion" required:"true" description:"The go version used to build the service, like 1.17 or 1.17.3."`
+	Main      string `json:"main" description:"The main package relative to the config file. Defaults to the folder of the config file."`
+	LdFlags   string `json:"ldflags" description:"The -ldflags given to go build, like -s -w."`
+	Cgo       bool   `json:"cgo" description:"Whether the binary is built with CGO_ENABLED=1. Defaults to false, which builds a static binary."`
+	Runtime   string `json:"runtime" enum:"distroless,scratch" description:"The image the binary runs in. Defaults to distroless."`
+}
+
+// findGoModuleRoot walks up from the project folder to the folder containing go.mod.
+// The module root must be inside the working directory, as it becomes part of the build context.
+func findGoModuleRoot(projectPath string) (string, error) {
+	folder := filepath.Clean(projectPath)
+	for {
+		if _, err := os.Stat(filepath.Join(folder, "go.mod")); err == nil {
+			return folder, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if folder == "." || folder == string(filepath.Separator) || strings.HasPrefix(folder, "..") {
+			return "", fmt.Errorf("could not find go.mod in path %s or any of its parent folders", projectPath)
+		}
+		folder = filepath.Dir(folder)
+	}
+}
+
+var goReplaceDirective = regexp.MustCompile(`^(?:replace\s+)?\S+(?:\s+\S+)?\s+=>\s+(\S+)\s*$`)
+
+// findLocalReplaceTargets returns the folders of the local modules the go.mod replaces dependencies with,
+// relative to the working directory.
+func findLocalReplaceTargets(moduleRoot string) ([]string, error) {
+	file, err := os.Open(filepath.Join(moduleRoot, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	targets := []string{}
+	inReplaceBlock := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.SplitN(scanner.Text(), "//", 2)[0])
+		switch {
+		case strings.HasPrefix(line, "replace") && strings.HasSuffix(line, "("):
+			inReplaceBlock = true
+			continue
+		case inReplaceBlock && line == ")":
+			inReplaceBlock = false
+			continue
+		case !inReplaceBlock && !strings.HasPrefix(line, "replace"):
+			continue
+		}
+
+		match := goReplaceDirective.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		target := match[1]
+		if !strings.HasPrefix(target, "./") && !strings.HasPrefix(target, "../") {
+			// The dependency is replaced by another module version, not a local folder.
+			continue
+		}
+
+		targetPath := filepath.Join(moduleRoot, target)
+		if strings.HasPrefix(targetPath, "..") {
+			return nil, fmt.Errorf("the replace target %s in %s is outside the working directory", target, filepath.Join(moduleRoot, "go.mod"))
+		}
+		targets = append(targets, targetPath)
+	}
+	return unique(targets), scanner.Err()
+}
+
+// getGoModuleFilesCopyCommand copies go.mod, and go.sum when it exists, of the module to the build stage.
+func getGoModuleFilesCopyCommand(module string) string {
+	files := []string{path.Join(module, "go.mod")}
+	if _, err := os.Stat(filepath.Join(module, "go.sum")); err == nil {
+		files = append(files, path.Join(module, "go.sum"))
+	}
+	return fmt.Sprintf("COPY %s %s/", strings.Join(files, " "), path.Join(DockerSrc, module))
+}
+
+func getGoRuntimeImage(builderConfig *GoBuilderConfig) (string, error) {
+	switch builderConfig.Runtime {
+	case "", "distroless":
+		if builderConfig.Cgo {
+			return "gcr.io/distroless/base-debian11", nil
+		}
+		return "gcr.io/distroless/static-debian11", nil
+	case "scratch":
+		if builderConfig.Cgo {
+			return "", fmt.Errorf("binaries built with cgo need a C library, which the scratch runtime does not have. Use the distroless runtime")
+		}
+		return "scratch", nil
+	}
+	return "", fmt.Errorf("invalid runtime value. given %s", builderConfig.Runtime)
+}
+
+var GoBuilder = &Builder{
+	BuilderNames: []string{"go"},
+	Config:       GoBuilderConfig{},
+	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+		builderConfig := &GoBuilderConfig{}
+		err := json.Unmarshal(conf.Builder, builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if builderConfig.GoVersion == "" {
+			return nil, fmt.Errorf("no goversion given in project %s at path %s", conf.ServiceName, conf.ProjectPath)
+		}
+
+		runtimeImage, err := getGoRuntimeImage(builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		moduleRoot, err := findGoModuleRoot(conf.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		replaceTargets, err := findLocalReplaceTargets(moduleRoot)
+		if err != nil {
+			return nil, err
+		}
+
+		mainPackage, err := filepath.Rel(moduleRoot, filepath.Join(conf.ProjectPath, builderConfig.Main))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(mainPackage, "..") {
+			return nil, fmt.Errorf("the main package %s is outside the module at path %s", mainPackage, moduleRoot)
+		}
+
+		modules := append([]string{moduleRoot}, replaceTargets...)
+		copyModuleFiles := []string{}
+		copyModules := []string{}
+		for _, module := range modules {
+			copyModuleFiles = append(copyModuleFiles, getGoModuleFilesCopyCommand(module))
+			copyModules = append(copyModules, getDockerCopyCommand(module, module))
+		}
+
+		cgoEnabled := 0
+		if builderConfig.Cgo {
+			cgoEnabled = 1
+		}
+
+		dockercontent := fmt.Sprintf(`
+			FROM golang:%s AS build-env
+
+			# Copy the module files and download the dependencies as a distinct layer
+			%s
+			WORKDIR %s
+			RUN go mod download
+
+			# Copy the sources and build
+			%s
+			RUN CGO_ENABLED=%d go build -trimpath -ldflags %q -o /out/service ./%s
+
+			# Build runtime image
+			FROM %s
+			COPY --from=build-env /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/
+			COPY --from=build-env /out/service /service
+			ENTRYPOINT ["/service"]
+		`, builderConfig.GoVersion, strings.Join(copyModuleFiles, "\n"), path.Join(DockerSrc, moduleRoot),
+			strings.Join(copyModules, "\n"), cgoEnabled, builderConfig.LdFlags, filepath.ToSlash(mainPackage), runtimeImage)
+
+		arguments := &BuildArguments{
+			DockerFileContent:       dockercontent,
+			SourcePaths:             modules,
+			DockerBuildContextPaths: getContextPathsInPlace(modules),
+		}
+		if err := writeGeneratedDockerfile(arguments); err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	},
+}
@@ -0,0 +1,455 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+type JvmBuilderConfig struct {
+	Type        string `json:"type"`
+	JavaVersion string `json:"javaversion" required:"true" description:"The java version used to build the service and the version of the JRE it runs on, like 17."`
+	Jar         string `json:"jar" description:"The jar started by the runtime, relative to the config file. Defaults to target/*.jar for maven and build/libs/*.jar for gradle."`
+}
+
+type JvmProjectType int
+
+const (
+	UnknownJvm JvmProjectType = iota
+	Maven
+	Gradle
+)
+
+// jvmProject describes the modules of the build the service is part of. Paths are relative to the working directory.
+type jvmProject struct {
+	ProjectType JvmProjectType
+	// RootDir is the folder of the root pom.xml or settings.gradle of a multi-module build.
+	RootDir string
+	// BuildFiles are the build files of the root and every module, and the buildSrc and gradle folders, needed to load the build.
+	BuildFiles []string
+	// ModuleDirs are the folders of the service module and the modules it depends on.
+	ModuleDirs []string
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func GetJvmProjectType(conf structs.ConfigurationWithProjectPath) (JvmProjectType, error) {
+	pomIsFound := fileExists(filepath.Join(conf.ProjectPath, "pom.xml"))
+	gradleIsFound := getGradleBuildFile(conf.ProjectPath) != ""
+
+	if pomIsFound && gradleIsFound {
+		return UnknownJvm, errors.New(fmt.Sprintf("Both pom.xml and build.gradle are found in the project %s at path %s. Please remove one of them", conf.ServiceName, conf.ProjectPath))
+	}
+	if pomIsFound {
+		return Maven, nil
+	}
+	if gradleIsFound {
+		return Gradle, nil
+	}
+	return UnknownJvm, errors.New(fmt.Sprintf("Neither pom.xml, build.gradle nor build.gradle.kts were found in the project %s at path %s. Please add one of them.", conf.ServiceName, conf.ProjectPath))
+}
+
+var (
+	pomModulePattern     = regexp.MustCompile(`<module>\s*([^<]+?)\s*</module>`)
+	pomParentPattern     = regexp.MustCompile(`(?s)<parent>.*?</parent>`)
+	pomArtifactIDPattern = regexp.MustCompile(`<artifactId>\s*([^<]+?)\s*</artifactId>`)
+	pomDependencyPattern = regexp.MustCompile(`(?s)<dependency>(.*?)</dependency>`)
+)
+
+func readPomModules(dir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "pom.xml"))
+	if err != nil {
+		return nil, err
+	}
+	modules := []string{}
+	for _, match := range pomModulePattern.FindAllStringSubmatch(string(content), -1) {
+		modules = append(modules, filepath.Join(dir, match[1]))
+	}
+	return modules, nil
+}
+
+// findMavenRoot walks up from the project folder as long as the parent pom.xml lists the folder as a module.
+func findMavenRoot(projectPath string) (string, error) {
+	dir := filepath.Clean(projectPath)
+	for dir != "." && !strings.HasPrefix(dir, "..") {
+		parent := filepath.Dir(dir)
+		if !fileExists(filepath.Join(parent, "pom.xml")) {
+			break
+		}
+		modules, err := readPomModules(parent)
+		if err != nil {
+			return "", err
+		}
+		if !containsPath(modules, dir) {
+			break
+		}
+		dir = parent
+	}
+	return dir, nil
+}
+
+func containsPath(paths []string, value string) bool {
+	for _, item := range paths {
+		if filepath.Clean(item) == filepath.Clean(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// findMavenModules returns the folder of every module below the root by artifactId, and the folders of their pom.xml files.
+func findMavenModules(dir string, modulesByArtifactID map[string]string, pomDirs []string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "pom.xml"))
+	if err != nil {
+		return nil, err
+	}
+	pomDirs = append(pomDirs, dir)
+	if match := pomArtifactIDPattern.FindStringSubmatch(pomParentPattern.ReplaceAllString(string(content), "")); match != nil {
+		modulesByArtifactID[match[1]] = dir
+	}
+
+	modules, err := readPomModules(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range modules {
+		pomDirs, err = findMavenModules(module, modulesByArtifactID, pomDirs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pomDirs, nil
+}
+
+// findMavenModuleDependencies follows the dependencies on other modules of the build, like the dotnet builder follows ProjectReference.
+func findMavenModuleDependencies(moduleDir string, modulesByArtifactID map[string]string, found []string) ([]string, error) {
+	if containsPath(found, moduleDir) {
+		return found, nil
+	}
+	found = append(found, moduleDir)
+
+	content, err := os.ReadFile(filepath.Join(moduleDir, "pom.xml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dependency := range pomDependencyPattern.FindAllStringSubmatch(string(content), -1) {
+		match := pomArtifactIDPattern.FindStringSubmatch(dependency[1])
+		if match == nil {
+			continue
+		}
+		if dependencyDir, isModule := modulesByArtifactID[match[1]]; isModule {
+			found, err = findMavenModuleDependencies(dependencyDir, modulesByArtifactID, found)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+func getMavenProject(projectPath string) (*jvmProject, error) {
+	rootDir, err := findMavenRoot(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	modulesByArtifactID := map[string]string{}
+	pomDirs, err := findMavenModules(rootDir, modulesByArtifactID, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	moduleDirs, err := findMavenModuleDependencies(filepath.Clean(projectPath), modulesByArtifactID, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	buildFiles := []string{}
+	for _, pomDir := range pomDirs {
+		buildFiles = append(buildFiles, filepath.Join(pomDir, "pom.xml"))
+	}
+	return &jvmProject{
+		ProjectType: Maven,
+		RootDir:     rootDir,
+		BuildFiles:  unique(buildFiles),
+		ModuleDirs:  moduleDirs,
+	}, nil
+}
+
+var (
+	gradleIncludePattern        = regexp.MustCompile(`(?m)^\s*include\b(.*)$`)
+	gradleQuotedPattern         = regexp.MustCompile(`["']([^"']+)["']`)
+	gradleProjectPattern        = regexp.MustCompile(`project\(\s*(?:path\s*[:=]\s*)?["'](:[^"']*)["']`)
+	gradleRootBuildFileNames    = []string{"settings.gradle", "settings.gradle.kts", "build.gradle", "build.gradle.kts", "gradle.properties"}
+	gradleProjectBuildFileNames = []string{"build.gradle", "build.gradle.kts"}
+)
+
+func getGradleBuildFile(dir string) string {
+	for _, name := range gradleProjectBuildFileNames {
+		if fileExists(filepath.Join(dir, name)) {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+func getGradleSettingsFile(dir string) string {
+	for _, name := range []string{"settings.gradle", "settings.gradle.kts"} {
+		if fileExists(filepath.Join(dir, name)) {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// findGradleRoot walks up from the project folder to the folder containing settings.gradle.
+// A project without settings.gradle is its own root.
+func findGradleRoot(projectPath string) string {
+	dir := filepath.Clean(projectPath)
+	for {
+		if getGradleSettingsFile(dir) != "" {
+			return dir
+		}
+		if dir == "." || strings.HasPrefix(dir, "..") {
+			return filepath.Clean(projectPath)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// getGradleProjectDir returns the folder of a project path like :libs:common, which gradle puts at libs/common by default.
+func getGradleProjectDir(rootDir string, projectPath string) string {
+	return filepath.Join(rootDir, filepath.FromSlash(strings.ReplaceAll(strings.TrimPrefix(projectPath, ":"), ":", "/")))
+}
+
+// getGradleProjectPath returns the gradle project path of the folder, like :libs:common.
+func getGradleProjectPath(rootDir string, dir string) (string, error) {
+	relativeDir, err := filepath.Rel(rootDir, dir)
+	if err != nil {
+		return "", err
+	}
+	if relativeDir == "." {
+		return "", nil
+	}
+	return ":" + strings.ReplaceAll(filepath.ToSlash(relativeDir), "/", ":"), nil
+}
+
+func findGradleProjectDependencies(rootDir string, projectDir string, found []string) ([]string, error) {
+	if containsPath(found, projectDir) {
+		return found, nil
+	}
+	found = append(found, projectDir)
+
+	buildFile := getGradleBuildFile(projectDir)
+	if buildFile == "" {
+		return nil, fmt.Errorf("could not find build.gradle or build.gradle.kts in path %s", projectDir)
+	}
+	content, err := os.ReadFile(buildFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range gradleProjectPattern.FindAllStringSubmatch(string(content), -1) {
+		found, err = findGradleProjectDependencies(rootDir, getGradleProjectDir(rootDir, match[1]), found)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+func getGradleProject(projectPath string) (*jvmProject, error) {
+	rootDir := findGradleRoot(projectPath)
+
+	buildFiles := []string{}
+	for _, name := range gradleRootBuildFileNames {
+		if fileExists(filepath.Join(rootDir, name)) {
+			buildFiles = append(buildFiles, filepath.Join(rootDir, name))
+		}
+	}
+
+	if settingsFile := getGradleSettingsFile(rootDir); settingsFile != "" {
+		content, err := os.ReadFile(settingsFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, include := range gradleIncludePattern.FindAllStringSubmatch(string(content), -1) {
+			for _, match := range gradleQuotedPattern.FindAllStringSubmatch(include[1], -1) {
+				if buildFile := getGradleBuildFile(getGradleProjectDir(rootDir, match[1])); buildFile != "" {
+					buildFiles = append(buildFiles, buildFile)
+				}
+			}
+		}
+	}
+
+	// buildSrc holds build logic, and gradle holds the version catalog libs.versions.toml and the wrapper.
+	for _, name := range []string{"buildSrc", "gradle"} {
+		if info, err := os.Stat(filepath.Join(rootDir, name)); err == nil && info.IsDir() {
+			buildFiles = append(buildFiles, filepath.Join(rootDir, name))
+		}
+	}
+
+	moduleDirs, err := findGradleProjectDependencies(rootDir, filepath.Clean(projectPath), []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &jvmProject{
+		ProjectType: Gradle,
+		RootDir:     rootDir,
+		BuildFiles:  unique(buildFiles),
+		ModuleDirs:  moduleDirs,
+	}, nil
+}
+
+func getJvmBuildCommands(project *jvmProject, projectPath string) (string, string, error) {
+	switch project.ProjectType {
+	case Maven:
+		projectList := ""
+		if relativeDir, err := filepath.Rel(project.RootDir, projectPath); err != nil {
+			return "", "", err
+		} else if relativeDir != "." {
+			projectList = fmt.Sprintf(" -pl %s -am", filepath.ToSlash(relativeDir))
+		}
+		return fmt.Sprintf("RUN mvn -B%s dependency:go-offline", projectList),
+			fmt.Sprintf("RUN mvn -B%s package -DskipTests", projectList), nil
+	case Gradle:
+		gradleProjectPath, err := getGradleProjectPath(project.RootDir, projectPath)
+		if err != nil {
+			return "", "", err
+		}
+		return fmt.Sprintf("RUN gradle %s:dependencies --no-daemon", gradleProjectPath),
+			fmt.Sprintf("RUN gradle %s:assemble --no-daemon", gradleProjectPath), nil
+	}
+	return "", "", errors.New("unknown jvm project type")
+}
+
+// derivedJarPatterns match the jars built next to the runnable jar, like the plain jar of spring boot, the jar
+// replaced by the maven shade plugin and the sources and javadoc jars, which the default jar globs match as well.
+var derivedJarPatterns = []string{`-plain\.jar$`, `-sources\.jar$`, `-javadoc\.jar$`, `-tests\.jar$`, `/original-[^/]*\.jar$`}
+
+// getJarSelectCommand copies the jar matching the glob to /out/service.jar, and fails unless exactly one jar matches.
+func getJarSelectCommand(jarGlob string, excludeDerivedJars bool) string {
+	filter := ""
+	if excludeDerivedJars {
+		excludes := []string{}
+		for _, pattern := range derivedJarPatterns {
+			excludes = append(excludes, fmt.Sprintf("-e '%s'", pattern))
+		}
+		filter = " | grep -v " + strings.Join(excludes, " ")
+	}
+	return fmt.Sprintf(`RUN set -- $(ls %s 2>/dev/null%s); if [ "$#" -ne 1 ]; then echo "expected a single jar matching %s, found: $*" >&2; exit 1; fi; mkdir -p /out && cp "$1" /out/service.jar`,
+		jarGlob, filter, jarGlob)
+}
+
+// getBuildOutputCleanCommand removes the build output copied from the working directory with the modules,
+// so jars built outside the image are never picked up.
+func getBuildOutputCleanCommand(project *jvmProject) string {
+	outputDir := "target"
+	if project.ProjectType == Gradle {
+		outputDir = "build"
+	}
+	outputDirs := []string{}
+	for _, moduleDir := range project.ModuleDirs {
+		outputDirs = append(outputDirs, path.Join(DockerSrc, filepath.ToSlash(moduleDir), outputDir))
+	}
+	return fmt.Sprintf("RUN rm -rf %s", strings.Join(outputDirs, " "))
+}
+
+var JvmBuilder = &Builder{
+	BuilderNames: []string{"jvm"},
+	Config:       JvmBuilderConfig{},
+	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+		builderConfig := &JvmBuilderConfig{}
+		err := json.Unmarshal(conf.Builder, builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if builderConfig.JavaVersion == "" {
+			return nil, errors.New(fmt.Sprintf("No javaversion given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+
+		jvmProjectType, err := GetJvmProjectType(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		var project *jvmProject
+		buildImage := ""
+		jar := builderConfig.Jar
+		if jvmProjectType == Maven {
+			project, err = getMavenProject(conf.ProjectPath)
+			buildImage = fmt.Sprintf("maven:3-eclipse-temurin-%s", builderConfig.JavaVersion)
+			if jar == "" {
+				jar = "target/*.jar"
+			}
+		} else {
+			project, err = getGradleProject(conf.ProjectPath)
+			buildImage = fmt.Sprintf("gradle:jdk%s", builderConfig.JavaVersion)
+			if jar == "" {
+				jar = "build/libs/*.jar"
+			}
+		}
+		// A jar given in the config is used as is, while the default globs skip the jars built next to the runnable one.
+		excludeDerivedJars := builderConfig.Jar == ""
+		if err != nil {
+			return nil, err
+		}
+
+		resolveCommand, packageCommand, err := getJvmBuildCommands(project, conf.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(project.BuildFiles)
+		sort.Strings(project.ModuleDirs)
+
+		dockercontent := fmt.Sprintf(`
+			FROM %s AS build-env
+
+			# Copy the build files and resolve the dependencies as a distinct layer
+			%s
+
+			WORKDIR %s
+			%s
+
+			# Copy the modules and package
+			%s
+			%s
+
+			%s
+			%s
+
+			# Build runtime image
+			FROM eclipse-temurin:%s-jre
+			WORKDIR /app
+			COPY --from=build-env /out/service.jar /app/service.jar
+			ENTRYPOINT ["java", "-jar", "/app/service.jar"]
+		`, buildImage, getDockerCopyCommandForDependency(project.BuildFiles), path.Join(DockerSrc, filepath.ToSlash(project.RootDir)),
+			resolveCommand, getDockerCopyCommandForDependency(project.ModuleDirs), getBuildOutputCleanCommand(project), packageCommand,
+			getJarSelectCommand(path.Join(DockerSrc, filepath.ToSlash(conf.ProjectPath), jar), excludeDerivedJars),
+			builderConfig.JavaVersion)
+
+		sourcePaths := append(project.ModuleDirs, project.BuildFiles...)
+		arguments := &BuildArguments{
+			DockerFileContent:       dockercontent,
+			SourcePaths:             sourcePaths,
+			DockerBuildContextPaths: getContextPathsInPlace(sourcePaths),
+		}
+		if err := writeGeneratedDockerfile(arguments); err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	},
+}
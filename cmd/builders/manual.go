@@ -9,8 +9,9 @@ import (
 )
 
 type ManualBuilderConf struct {
-	BuildContext string `json:buildcontext`
-	DockerFile   string `json:dockerfile`
+	Type         string `json:"type"`
+	BuildContext string `json:"buildcontext" enum:"root,projectdir" description:"Whether the Dockerfile is built with the root folder or the project folder as context. Defaults to root."`
+	DockerFile   string `json:"dockerfile" description:"The Dockerfile relative to the config file. Defaults to Dockerfile."`
 }
 
 /*
@@ -28,6 +29,7 @@ dockerfile?: string;
 
 var ManualBuilder = &Builder{
 	BuilderNames: []string{"manual", ""},
+	Config:       ManualBuilderConf{},
 	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
 		builderConfig := &ManualBuilderConf{}
 		err := json.Unmarshal(conf.Builder, builderConfig)
@@ -35,24 +37,26 @@ var ManualBuilder = &Builder{
 			return nil, err
 		}
 
-		contextPaths := map[string]string{}
+		dockerFile := builderConfig.DockerFile
+		if dockerFile == "" {
+			dockerFile = "Dockerfile"
+		}
 
 		if builderConfig.BuildContext == "root" || builderConfig.BuildContext == "" {
 			return &BuildArguments{
 				DockerBuildContextPaths: map[string]string{
 					".": "",
 				},
-				DockerFilePath: filepath.Join(conf.ProjectPath, builderConfig.DockerFile),
+				DockerFilePath: filepath.Join(conf.ProjectPath, dockerFile),
 			}, nil
 
 		} else if builderConfig.BuildContext == "projectdir" {
 			return &BuildArguments{
 				DockerBuildContextPaths: map[string]string{
-					".": "",
+					conf.ProjectPath: "",
 				},
-				DockerFilePath: filepath.Join(conf.ProjectPath, builderConfig.DockerFile),
+				DockerFilePath: dockerFile,
 			}, nil
-			contextPaths[conf.ProjectPath] = ""
 		}
 
 		return nil, fmt.Errorf("invalid buildContext value. given %s", builderConfig.BuildContext)
@@ -4,18 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/groenlid/docker-builder/cmd/structs"
 )
 
 type NodejsBuilderConfig struct {
 	Type         string `json:"type"`
-	NodeVersion  string `json:"nodeversion"`
-	BuildCommand string `json:"buildcommand"`
-	RunCommand   string `json:"runcommand"`
+	NodeVersion  string `json:"nodeversion" required:"true" description:"The node version used to build and run the service, like 12 or 12.14.1."`
+	BuildCommand string `json:"buildcommand" description:"The command building the service, like npm run build."`
+	RunCommand   string `json:"runcommand" required:"true" description:"The command running the service, like npm start."`
+	OutputDir    string `json:"outputdir" description:"The folder the build command writes the service to, relative to the config file. Only this folder, package.json and the production dependencies end up in the runtime image. Defaults to every file of the service, like ."`
 }
 
 type NodeProjectType int
@@ -24,38 +25,142 @@ const (
 	Unknown NodeProjectType = iota
 	Npm
 	Yarn
+	YarnBerry
+	Pnpm
 )
 
+// nodeLockFiles maps the lockfile of a project to the package manager installing it.
+var nodeLockFiles = []struct {
+	LockFile    string
+	ProjectType NodeProjectType
+}{
+	{"package-lock.json", Npm},
+	{"yarn.lock", Yarn},
+	{"pnpm-lock.yaml", Pnpm},
+}
+
+type packageJSON struct {
+	Name                 string            `json:"name"`
+	PackageManager       string            `json:"packageManager"`
+	Workspaces           json.RawMessage   `json:"workspaces"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+}
+
+func readPackageJSON(dir string) (*packageJSON, error) {
+	content, err := os.ReadFile(path.Join(dir, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	packageFile := &packageJSON{}
+	if err := json.Unmarshal(content, packageFile); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path.Join(dir, "package.json"), err)
+	}
+	return packageFile, nil
+}
+
+// isYarnBerry returns whether yarn 2 or later is used, which is configured in .yarnrc.yml and ships its release in .yarn/releases.
+func isYarnBerry(projectPath string, packageManager string) bool {
+	if _, err := os.Stat(path.Join(projectPath, ".yarnrc.yml")); err == nil {
+		return true
+	}
+	if info, err := os.Stat(path.Join(projectPath, ".yarn", "releases")); err == nil && info.IsDir() {
+		return true
+	}
+	return strings.HasPrefix(packageManager, "yarn@") && !strings.HasPrefix(packageManager, "yarn@1.")
+}
+
+// GetNodeProjectType returns the package manager of the project, or of the workspace the project is part of.
 func GetNodeProjectType(conf structs.ConfigurationWithProjectPath) (NodeProjectType, error) {
-	direntries, err := os.ReadDir(conf.ProjectPath)
+	project, err := getNodeProject(conf)
 	if err != nil {
 		return Unknown, err
 	}
+	return project.ProjectType, nil
+}
 
-	yarnLockIsFound := false
-	packacgeLockIsFound := false
-	for _, direntry := range direntries {
-		if direntry.Name() == "yarn.lock" {
-			yarnLockIsFound = true
+// getNodeProjectTypeInPath detects the package manager from the lockfile in the folder.
+func getNodeProjectTypeInPath(conf structs.ConfigurationWithProjectPath, lockFileDir string) (NodeProjectType, error) {
+	foundLockFiles := []string{}
+	projectType := Unknown
+	for _, nodeLockFile := range nodeLockFiles {
+		if _, err := os.Stat(path.Join(lockFileDir, nodeLockFile.LockFile)); err == nil {
+			foundLockFiles = append(foundLockFiles, nodeLockFile.LockFile)
+			projectType = nodeLockFile.ProjectType
+		} else if !os.IsNotExist(err) {
+			return Unknown, err
 		}
-		if direntry.Name() == "package-lock.json" {
-			packacgeLockIsFound = true
+	}
+
+	if len(foundLockFiles) > 1 {
+		return Unknown, errors.New(fmt.Sprintf("Found the lockfiles %s in the project %s at path %s, but only one package manager can be used. Please remove all but one of them", strings.Join(foundLockFiles, " and "), conf.ServiceName, lockFileDir))
+	}
+	if len(foundLockFiles) == 0 {
+		return Unknown, errors.New(fmt.Sprintf("Neither package-lock.json, yarn.lock nor pnpm-lock.yaml were found in the project %s at path %s. Please add one of them.", conf.ServiceName, lockFileDir))
+	}
+
+	packageFile, err := readPackageJSON(lockFileDir)
+	if err != nil {
+		return Unknown, err
+	}
+	if projectType == Yarn && isYarnBerry(lockFileDir, packageFile.PackageManager) {
+		projectType = YarnBerry
+	}
+
+	if packageFile.PackageManager != "" {
+		packageManager := strings.SplitN(packageFile.PackageManager, "@", 2)[0]
+		if packageManager != getPackageManagerName(projectType) {
+			return Unknown, errors.New(fmt.Sprintf("The packageManager %s in package.json does not match the lockfile %s in the project %s at path %s", packageFile.PackageManager, foundLockFiles[0], conf.ServiceName, lockFileDir))
 		}
 	}
+	return projectType, nil
+}
 
-	if yarnLockIsFound && packacgeLockIsFound {
-		return Unknown, errors.New(fmt.Sprintf("Both yarn.lock and package-lock.json are found in the project %s at path %s. Please remove one of them", conf.ServiceName, conf.ProjectPath))
+func getPackageManagerName(projectType NodeProjectType) string {
+	switch projectType {
+	case Npm:
+		return "npm"
+	case Yarn, YarnBerry:
+		return "yarn"
+	case Pnpm:
+		return "pnpm"
 	}
+	return ""
+}
 
-	if yarnLockIsFound {
-		return Yarn, nil
+func getLockFile(projectType NodeProjectType) string {
+	for _, nodeLockFile := range nodeLockFiles {
+		if nodeLockFile.ProjectType == projectType || (projectType == YarnBerry && nodeLockFile.ProjectType == Yarn) {
+			return nodeLockFile.LockFile
+		}
 	}
-	if packacgeLockIsFound {
-		return Npm, nil
+	return ""
+}
+
+// getInstallFilesCopyCommand copies the files the package manager needs to install the dependencies.
+func getInstallFilesCopyCommand(projectPath string, projectType NodeProjectType) string {
+	files := []string{"package.json", getLockFile(projectType)}
+	if _, err := os.Stat(path.Join(projectPath, "pnpm-workspace.yaml")); err == nil && projectType == Pnpm {
+		files = append(files, "pnpm-workspace.yaml")
 	}
-	return Unknown, errors.New(fmt.Sprintf("Neither yarn.lock and package-lock.json were found in the project %s at path %s. Please add one of them.", conf.ServiceName, conf.ProjectPath))
+	copyCommands := []string{}
+	if projectType == YarnBerry {
+		if _, err := os.Stat(path.Join(projectPath, ".yarnrc.yml")); err == nil {
+			files = append(files, ".yarnrc.yml")
+		}
+		for _, folder := range []string{".yarn/releases", ".yarn/plugins", ".yarn/patches"} {
+			if info, err := os.Stat(path.Join(projectPath, folder)); err == nil && info.IsDir() {
+				copyCommands = append(copyCommands, fmt.Sprintf("COPY %s ./%s", folder, folder))
+			}
+		}
+	}
+	return strings.Join(append([]string{fmt.Sprintf("COPY %s ./", strings.Join(files, " "))}, copyCommands...), "\n")
 }
 
+// getInstallCommand installs the dependencies exactly as given in the lockfile.
+// Yarn berry and pnpm are enabled with corepack, which uses the version given in packageManager in package.json.
 func getInstallCommand(projectType NodeProjectType) string {
 	switch projectType {
 	case Unknown:
@@ -63,13 +168,69 @@ func getInstallCommand(projectType NodeProjectType) string {
 	case Npm:
 		return "RUN npm ci"
 	case Yarn:
-		return "RUN yarn"
+		return "RUN yarn install --frozen-lockfile"
+	case YarnBerry:
+		return "RUN corepack enable && yarn install --immutable"
+	case Pnpm:
+		return "RUN corepack enable && pnpm install --frozen-lockfile"
 	}
 	return ""
 }
 
+// getPruneCommand removes the devDependencies installed in the build stage.
+// npm 6, which comes with node 12 and 14, does not know --omit=dev, while later versions still accept --production.
+func getPruneCommand(project *nodeProject) string {
+	switch project.ProjectType {
+	case Npm:
+		return "RUN npm prune --production"
+	case Yarn:
+		return "RUN yarn install --frozen-lockfile --production --ignore-scripts --prefer-offline"
+	case YarnBerry:
+		if project.IsWorkspace {
+			return fmt.Sprintf("RUN yarn workspaces focus --production %s", project.PackageName)
+		}
+		return "RUN yarn workspaces focus --all --production"
+	case Pnpm:
+		// pnpm prune does not support workspaces, so the production dependencies of the package are installed again.
+		if project.IsWorkspace {
+			return fmt.Sprintf("RUN find . -name node_modules -type d -prune -exec rm -rf {} + && pnpm install --prod --frozen-lockfile --prefer-offline --filter %s...", project.PackageName)
+		}
+		return "RUN pnpm prune --prod"
+	}
+	return ""
+}
+
+// getRuntimeSetupCommand enables the package manager in the runtime stage, so the runcommand can call it.
+// Yarn berry and pnpm are provided by corepack, while npm and yarn classic come with the node image.
+func getRuntimeSetupCommand(projectType NodeProjectType) string {
+	switch projectType {
+	case YarnBerry, Pnpm:
+		return "RUN corepack enable"
+	}
+	return ""
+}
+
+// nodeRuntimeFiles are needed to resolve the dependencies at runtime. The yarn plug'n'play loader and the yarn config
+// are at the root of a project that is not part of a workspace, which is then the service folder.
+var nodeRuntimeFiles = []string{"package.json", "node_modules", ".pnp.cjs", ".pnp.loader.mjs", ".yarnrc.yml", ".yarn"}
+
+// getOutputOnlyCommand removes everything but the runtime files and the output folder from the service folder.
+// An outputdir of . is the whole service folder, so nothing is removed.
+func getOutputOnlyCommand(serviceDir string, outputDir string) string {
+	outputFolder := strings.Split(path.Clean(outputDir), "/")[0]
+	if outputDir == "" || outputFolder == "." {
+		return ""
+	}
+	keptFiles := []string{}
+	for _, file := range append(nodeRuntimeFiles, outputFolder) {
+		keptFiles = append(keptFiles, fmt.Sprintf("! -name '%s'", file))
+	}
+	return fmt.Sprintf("RUN find %s -mindepth 1 -maxdepth 1 %s -exec rm -rf {} +", serviceDir, strings.Join(keptFiles, " "))
+}
+
 var NodeBuilder = &Builder{
 	BuilderNames: []string{"nodejs"},
+	Config:       NodejsBuilderConfig{},
 	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
 		builderConfig := &NodejsBuilderConfig{}
 		err := json.Unmarshal(conf.Builder, builderConfig)
@@ -77,22 +238,27 @@ var NodeBuilder = &Builder{
 			return nil, err
 		}
 
-		nodeProjectType, err := GetNodeProjectType(conf)
-
+		project, err := getNodeProject(conf)
 		if err != nil {
 			return nil, err
 		}
 
-		if nodeProjectType == Unknown {
+		if project.ProjectType == Unknown {
 			return nil, errors.New(fmt.Sprintf("Could not get node project type for project %s at path %s", conf.ServiceName, conf.ProjectPath))
 		}
 
-		lockFile := "yarn.lock"
-		if nodeProjectType == Npm {
-			lockFile = "package-lock.json"
+		installCommands, err := project.getInstallCommands()
+		if err != nil {
+			return nil, err
+		}
+		copySources, err := project.getSourcesCopyCommand()
+		if err != nil {
+			return nil, err
+		}
+		serviceDir, err := project.getServiceDir(conf.ProjectPath)
+		if err != nil {
+			return nil, err
 		}
-
-		installCommand := getInstallCommand(nodeProjectType)
 
 		buildCommand := ""
 		if builderConfig.BuildCommand != "" {
@@ -103,41 +269,45 @@ var NodeBuilder = &Builder{
 			return nil, errors.New(fmt.Sprintf("No runcommand given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
 		}
 
+		if strings.HasPrefix(path.Clean(builderConfig.OutputDir), "..") || path.IsAbs(builderConfig.OutputDir) {
+			return nil, errors.New(fmt.Sprintf("The outputdir %s must be inside the project %s at path %s", builderConfig.OutputDir, conf.ServiceName, conf.ProjectPath))
+		}
+
 		dockercontent := fmt.Sprintf(`
-			FROM node:%s-alpine
+			FROM node:%s-alpine AS build-env
 
 			WORKDIR /usr/src/app
-			COPY package.json %s ./
-
 			%s
 
-			COPY / ./
+			%s
 
+			WORKDIR %s
 			%s
 
-			CMD %s
-		`, builderConfig.NodeVersion, lockFile, installCommand, buildCommand, builderConfig.RunCommand)
+			# Remove the devDependencies, and the files of the service that are not part of the output
+			WORKDIR /usr/src/app
+			%s
+			%s
 
-		tmpDir, err := ioutil.TempDir("", "")
+			# Build runtime image
+			FROM node:%s-alpine
+			ENV NODE_ENV=production
+			WORKDIR /usr/src/app
+			COPY --from=build-env --chown=node:node /usr/src/app ./
+			%s
+			WORKDIR %s
+			USER node
 
-		if err != nil {
-			return nil, err
-		}
+			CMD %s
+		`, builderConfig.NodeVersion, installCommands, copySources, serviceDir, buildCommand,
+			getPruneCommand(project), getOutputOnlyCommand(serviceDir, builderConfig.OutputDir),
+			builderConfig.NodeVersion, getRuntimeSetupCommand(project.ProjectType), serviceDir, builderConfig.RunCommand)
 
-		dockerFilePath := path.Join(tmpDir, "Dockerfile")
-		bytesToSend := []byte(dockercontent)
-		err = os.WriteFile(dockerFilePath, bytesToSend, 0755)
+		arguments, err := project.getBuildArguments(dockercontent, nil)
 		if err != nil {
 			return nil, err
 		}
 
-		arguments := &BuildArguments{
-			DockerBuildContextPaths: map[string]string{
-				conf.ProjectPath: "",
-				tmpDir:           "",
-			},
-		}
-
 		return arguments, nil
 	},
 }
@@ -0,0 +1,31 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetOutputOnlyCommand(t *testing.T) {
+	tests := []struct {
+		outputDir string
+		kept      string
+	}{
+		{"", ""},
+		{".", ""},
+		{"./", ""},
+		{"dist", "! -name 'dist'"},
+		{"./dist/server", "! -name 'dist'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.outputDir, func(t *testing.T) {
+			command := getOutputOnlyCommand("/usr/src/app", test.outputDir)
+			if test.kept == "" && command != "" {
+				t.Errorf("expected every file of the service to be kept, got %s", command)
+			}
+			if test.kept != "" && !strings.Contains(command, test.kept) {
+				t.Errorf("expected %s in %s", test.kept, command)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"gopkg.in/yaml.v3"
+)
+
+// nodeProject describes the node project of a service. Paths are relative to the working directory.
+type nodeProject struct {
+	ProjectType NodeProjectType
+	// RootDir is the folder of the workspace root, or the project folder when the service is not part of a workspace.
+	RootDir     string
+	IsWorkspace bool
+	PackageName string
+	// PackageDirs are the folders of the service package and the workspace packages it depends on.
+	PackageDirs []string
+	// WorkspaceDirs are the folders of every package in the workspace.
+	WorkspaceDirs []string
+}
+
+// getWorkspacePatterns returns the package folders of the workspace with its root in the folder,
+// from pnpm-workspace.yaml or the workspaces field of package.json.
+func getWorkspacePatterns(dir string) ([]string, bool, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "pnpm-workspace.yaml"))
+	if err == nil {
+		pnpmWorkspace := struct {
+			Packages []string `yaml:"packages"`
+		}{}
+		if err := yaml.Unmarshal(content, &pnpmWorkspace); err != nil {
+			return nil, false, fmt.Errorf("unable to read %s: %v", filepath.Join(dir, "pnpm-workspace.yaml"), err)
+		}
+		return pnpmWorkspace.Packages, true, nil
+	} else if !os.IsNotExist(err) {
+		return nil, false, err
+	}
+
+	if !fileExists(filepath.Join(dir, "package.json")) {
+		return nil, false, nil
+	}
+	packageFile, err := readPackageJSON(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(packageFile.Workspaces) == 0 {
+		return nil, false, nil
+	}
+
+	// The workspaces are either a list of folders, or an object with the folders in packages.
+	patterns := []string{}
+	if err := json.Unmarshal(packageFile.Workspaces, &patterns); err == nil {
+		return patterns, true, nil
+	}
+	workspaces := struct {
+		Packages []string `json:"packages"`
+	}{}
+	if err := json.Unmarshal(packageFile.Workspaces, &workspaces); err != nil {
+		return nil, false, fmt.Errorf("unable to read the workspaces of %s: %v", filepath.Join(dir, "package.json"), err)
+	}
+	return workspaces.Packages, true, nil
+}
+
+// findNodeWorkspaceRoot walks up from the project folder to the folder declaring a workspace.
+func findNodeWorkspaceRoot(projectPath string) (string, []string, error) {
+	dir := filepath.Clean(projectPath)
+	for dir != "." && !strings.HasPrefix(dir, "..") {
+		dir = filepath.Dir(dir)
+		patterns, found, err := getWorkspacePatterns(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		if found {
+			return dir, patterns, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// expandWorkspacePattern returns the package folders matching a pattern like packages/* or apps/**.
+func expandWorkspacePattern(rootDir string, pattern string) ([]string, error) {
+	if !strings.HasSuffix(pattern, "/**") {
+		return filepath.Glob(filepath.Join(rootDir, pattern))
+	}
+
+	parents, err := filepath.Glob(filepath.Join(rootDir, strings.TrimSuffix(pattern, "/**")))
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, parent := range parents {
+		err := filepath.Walk(parent, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			if info.IsDir() && path != parent {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// findWorkspacePackages returns the folder of every package in the workspace by package name.
+func findWorkspacePackages(rootDir string, patterns []string) (map[string]string, error) {
+	included := []string{}
+	excluded := []string{}
+	for _, pattern := range patterns {
+		isExclusion := strings.HasPrefix(pattern, "!")
+		matches, err := expandWorkspacePattern(rootDir, strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, err
+		}
+		if isExclusion {
+			excluded = append(excluded, matches...)
+		} else {
+			included = append(included, matches...)
+		}
+	}
+
+	packagesByName := map[string]string{}
+	for _, dir := range included {
+		if containsPath(excluded, dir) || !fileExists(filepath.Join(dir, "package.json")) {
+			continue
+		}
+		packageFile, err := readPackageJSON(dir)
+		if err != nil {
+			return nil, err
+		}
+		if packageFile.Name != "" {
+			packagesByName[packageFile.Name] = filepath.Clean(dir)
+		}
+	}
+	return packagesByName, nil
+}
+
+// findWorkspacePackageDependencies follows the dependencies on other packages of the workspace,
+// like the dotnet builder follows ProjectReference.
+func findWorkspacePackageDependencies(packageDir string, packagesByName map[string]string, found []string) ([]string, error) {
+	if containsPath(found, packageDir) {
+		return found, nil
+	}
+	found = append(found, packageDir)
+
+	packageFile, err := readPackageJSON(packageDir)
+	if err != nil {
+		return nil, err
+	}
+	dependencies := []string{}
+	for _, dependencyGroup := range []map[string]string{packageFile.Dependencies, packageFile.DevDependencies, packageFile.OptionalDependencies, packageFile.PeerDependencies} {
+		for dependency := range dependencyGroup {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	sort.Strings(dependencies)
+
+	for _, dependency := range dependencies {
+		if dependencyDir, isWorkspacePackage := packagesByName[dependency]; isWorkspacePackage {
+			found, err = findWorkspacePackageDependencies(dependencyDir, packagesByName, found)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+func getNodeProject(conf structs.ConfigurationWithProjectPath) (*nodeProject, error) {
+	projectPath := filepath.Clean(conf.ProjectPath)
+	project := &nodeProject{
+		RootDir:     projectPath,
+		PackageDirs: []string{projectPath},
+	}
+
+	rootDir, patterns, err := findNodeWorkspaceRoot(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if rootDir != "" {
+		packagesByName, err := findWorkspacePackages(rootDir, patterns)
+		if err != nil {
+			return nil, err
+		}
+		for name, dir := range packagesByName {
+			if dir == projectPath {
+				project.IsWorkspace = true
+				project.RootDir = rootDir
+				project.PackageName = name
+			}
+		}
+		// A project below a workspace root that is not one of its packages is built on its own.
+		if project.IsWorkspace {
+			project.PackageDirs, err = findWorkspacePackageDependencies(projectPath, packagesByName, []string{})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(project.PackageDirs)
+			for _, dir := range packagesByName {
+				project.WorkspaceDirs = append(project.WorkspaceDirs, dir)
+			}
+			sort.Strings(project.WorkspaceDirs)
+		}
+	}
+
+	project.ProjectType, err = getNodeProjectTypeInPath(conf, project.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// getManifestDirs returns the folders of the packages whose package.json is needed to install the dependencies.
+// npm and yarn classic install the whole workspace, and refuse the lockfile when a workspace package is missing.
+func (p *nodeProject) getManifestDirs() []string {
+	switch p.ProjectType {
+	case Npm, Yarn:
+		return p.WorkspaceDirs
+	}
+	return p.PackageDirs
+}
+
+// getRelativePackageDirs returns the package folders relative to the workspace root, as they are in the build context.
+func (p *nodeProject) getRelativePackageDirs() ([]string, error) {
+	return p.getRelativeDirs(p.PackageDirs)
+}
+
+func (p *nodeProject) getRelativeDirs(packageDirs []string) ([]string, error) {
+	dirs := []string{}
+	for _, packageDir := range packageDirs {
+		dir, err := filepath.Rel(p.RootDir, packageDir)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, filepath.ToSlash(dir))
+	}
+	return dirs, nil
+}
+
+// getInstallCommands copies the files needed to install the dependencies and installs them.
+// In a pnpm or yarn berry workspace only the package.json of the packages needed by the service are copied.
+func (p *nodeProject) getInstallCommands() (string, error) {
+	if !p.IsWorkspace {
+		return getInstallFilesCopyCommand(p.RootDir, p.ProjectType) + "\n" + getInstallCommand(p.ProjectType), nil
+	}
+
+	dirs, err := p.getRelativeDirs(p.getManifestDirs())
+	if err != nil {
+		return "", err
+	}
+	commands := []string{getInstallFilesCopyCommand(p.RootDir, p.ProjectType)}
+	for _, dir := range dirs {
+		commands = append(commands, fmt.Sprintf("COPY %s ./%s/", path.Join(dir, "package.json"), dir))
+	}
+	commands = append(commands, getWorkspaceInstallCommand(p.ProjectType, p.PackageName))
+	return strings.Join(commands, "\n"), nil
+}
+
+// getWorkspaceInstallCommand installs the dependencies of the workspace package as given in the lockfile.
+// pnpm and yarn berry only install the package and the workspace packages it depends on.
+// yarn only enables immutable installs by default when it detects a CI, so they are enabled explicitly.
+func getWorkspaceInstallCommand(projectType NodeProjectType, packageName string) string {
+	switch projectType {
+	case YarnBerry:
+		return fmt.Sprintf("RUN corepack enable && YARN_ENABLE_IMMUTABLE_INSTALLS=true yarn workspaces focus %s", packageName)
+	case Pnpm:
+		return fmt.Sprintf("RUN corepack enable && pnpm install --frozen-lockfile --filter %s...", packageName)
+	}
+	return getInstallCommand(projectType)
+}
+
+// getSourcesCopyCommand copies the sources of the service, and in a workspace the packages it depends on.
+func (p *nodeProject) getSourcesCopyCommand() (string, error) {
+	if !p.IsWorkspace {
+		return "COPY / ./", nil
+	}
+
+	dirs, err := p.getRelativePackageDirs()
+	if err != nil {
+		return "", err
+	}
+	commands := []string{}
+	for _, dir := range dirs {
+		commands = append(commands, fmt.Sprintf("COPY %s ./%s", dir, dir))
+	}
+	return strings.Join(commands, "\n"), nil
+}
+
+// getServiceDir returns the folder of the service inside the image.
+func (p *nodeProject) getServiceDir(projectPath string) (string, error) {
+	dir, err := filepath.Rel(p.RootDir, filepath.Clean(projectPath))
+	if err != nil {
+		return "", err
+	}
+	return path.Join("/usr/src/app", filepath.ToSlash(dir)), nil
+}
+
+// getBuildArguments returns the build context of the project with the generated Dockerfile.
+// In a workspace the context is the workspace root, while only the needed packages affect the image.
+func (p *nodeProject) getBuildArguments(dockercontent string, files map[string]string) (*BuildArguments, error) {
+	arguments := &BuildArguments{
+		DockerFileContent: dockercontent,
+		DockerBuildContextPaths: map[string]string{
+			p.RootDir: "",
+		},
+	}
+	if p.IsWorkspace {
+		arguments.SourcePaths = append([]string{}, p.PackageDirs...)
+		for _, dir := range p.getManifestDirs() {
+			arguments.SourcePaths = append(arguments.SourcePaths, filepath.Join(dir, "package.json"))
+		}
+		for _, name := range []string{"package.json", getLockFile(p.ProjectType), "pnpm-workspace.yaml", ".yarnrc.yml", ".yarn"} {
+			if _, err := os.Stat(filepath.Join(p.RootDir, name)); err == nil {
+				arguments.SourcePaths = append(arguments.SourcePaths, filepath.Join(p.RootDir, name))
+			}
+		}
+	}
+
+	generatedFiles := map[string]string{"Dockerfile": dockercontent}
+	for name, content := range files {
+		generatedFiles[name] = content
+	}
+	if err := writeGeneratedFiles(arguments, generatedFiles); err != nil {
+		return nil, err
+	}
+	return arguments, nil
+}
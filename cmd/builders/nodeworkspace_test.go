@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// writeWorkspace writes the files of a node workspace to a new temporary folder and returns the folder.
+func writeWorkspace(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "docker-builder-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// npmWorkspace has the service api depending on core, and the package unused that no one depends on.
+var npmWorkspace = map[string]string{
+	"package.json":                 `{"name":"root","private":true,"workspaces":["packages/*"]}`,
+	"packages/api/package.json":    `{"name":"api","version":"1.0.0","dependencies":{"core":"1.0.0"},"scripts":{"build":"node build.js"}}`,
+	"packages/api/build.js":        `require("core"); require("fs").writeFileSync("dist.js", "console.log('api')");`,
+	"packages/core/package.json":   `{"name":"core","version":"1.0.0","main":"index.js"}`,
+	"packages/core/index.js":       `module.exports = {};`,
+	"packages/unused/package.json": `{"name":"unused","version":"1.0.0"}`,
+	"packages/unused/index.js":     `module.exports = {};`,
+	"package-lock.json": `{
+  "name": "root",
+  "lockfileVersion": 2,
+  "requires": true,
+  "packages": {
+    "": {"name": "root", "workspaces": ["packages/*"]},
+    "node_modules/api": {"resolved": "packages/api", "link": true},
+    "node_modules/core": {"resolved": "packages/core", "link": true},
+    "node_modules/unused": {"resolved": "packages/unused", "link": true},
+    "packages/api": {"name": "api", "version": "1.0.0", "dependencies": {"core": "1.0.0"}},
+    "packages/core": {"name": "core", "version": "1.0.0"},
+    "packages/unused": {"name": "unused", "version": "1.0.0"}
+  },
+  "dependencies": {
+    "api": {"version": "file:packages/api", "requires": {"core": "1.0.0"}},
+    "core": {"version": "file:packages/core"},
+    "unused": {"version": "file:packages/unused"}
+  }
+}
+`,
+}
+
+func getWorkspaceServiceArguments(t *testing.T, dir string) *BuildArguments {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	arguments, err := NodeBuilder.GetBuildArguments(structs.ConfigurationWithProjectPath{
+		Configuration: structs.Configuration{
+			ServiceName: "api",
+			Builder:     json.RawMessage(`{"type":"nodejs","nodeversion":"16","buildcommand":"npm run build","runcommand":"node dist.js"}`),
+		},
+		ProjectPath: filepath.Join("packages", "api"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(arguments.Cleanup)
+	return arguments
+}
+
+func TestNpmWorkspaceCopiesEveryPackageManifest(t *testing.T) {
+	arguments := getWorkspaceServiceArguments(t, writeWorkspace(t, npmWorkspace))
+
+	for _, manifest := range []string{"packages/api/package.json", "packages/core/package.json", "packages/unused/package.json"} {
+		if !strings.Contains(arguments.DockerFileContent, "COPY "+manifest+" ") {
+			t.Errorf("expected %s to be copied before the install", manifest)
+		}
+	}
+	if strings.Contains(arguments.DockerFileContent, "COPY packages/unused ./packages/unused") {
+		t.Error("expected the sources of the unused package not to be copied")
+	}
+}
+
+func TestPnpmWorkspaceCopiesTheManifestsOfTheServiceDependencies(t *testing.T) {
+	files := map[string]string{}
+	for name, content := range npmWorkspace {
+		if name != "package-lock.json" {
+			files[name] = content
+		}
+	}
+	files["pnpm-lock.yaml"] = "lockfileVersion: 5.4\n"
+	files["pnpm-workspace.yaml"] = "packages:\n  - packages/*\n"
+	arguments := getWorkspaceServiceArguments(t, writeWorkspace(t, files))
+
+	if !strings.Contains(arguments.DockerFileContent, "COPY packages/core/package.json ") {
+		t.Error("expected the package.json of core to be copied before the install")
+	}
+	if strings.Contains(arguments.DockerFileContent, "packages/unused") {
+		t.Error("expected the unused package not to be copied")
+	}
+	if strings.Contains(arguments.DockerFileContent, "pnpm prune") || !strings.Contains(arguments.DockerFileContent, "pnpm install --prod --frozen-lockfile --prefer-offline --filter api...") {
+		t.Error("expected the production dependencies to be installed again instead of pruned, as pnpm prune does not support workspaces")
+	}
+}
+
+// TestNpmWorkspaceDockerBuild builds the service to check that npm ci accepts the copied workspace.
+func TestNpmWorkspaceDockerBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the docker build in short mode")
+	}
+	if err := exec.Command("docker", "version").Run(); err != nil {
+		t.Skip("skipping the docker build, as docker is not available")
+	}
+
+	dir := writeWorkspace(t, npmWorkspace)
+	arguments := getWorkspaceServiceArguments(t, dir)
+
+	dockerfile := ""
+	for contextPath := range arguments.DockerBuildContextPaths {
+		if _, err := os.Stat(filepath.Join(contextPath, "Dockerfile")); err == nil && contextPath != "." {
+			dockerfile = filepath.Join(contextPath, "Dockerfile")
+		}
+	}
+	if dockerfile == "" {
+		t.Fatal("expected a generated Dockerfile in the build context")
+	}
+
+	build := exec.Command("docker", "build", "--file", dockerfile, dir)
+	build.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("expected the workspace service to build: %v\n%s", err, output)
+	}
+}
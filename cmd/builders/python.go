@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+type PythonBuilderConfig struct {
+	Type          string `json:"type"`
+	PythonVersion string `json:"pythonversion" required:"true" description:"The python version used to run the service, like 3.9 or 3.9.7."`
+	RunCommand    string `json:"runcommand" required:"true" description:"The command running the service, like python main.py."`
+}
+
+type PythonProjectType int
+
+const (
+	UnknownPython PythonProjectType = iota
+	Pip
+	Poetry
+	Pipenv
+	Uv
+)
+
+// pythonLockFiles maps the file pinning the dependencies to the tool installing them.
+var pythonLockFiles = []struct {
+	LockFile    string
+	ProjectType PythonProjectType
+}{
+	{"requirements.txt", Pip},
+	{"poetry.lock", Poetry},
+	{"Pipfile.lock", Pipenv},
+	{"uv.lock", Uv},
+}
+
+func GetPythonProjectType(conf structs.ConfigurationWithProjectPath) (PythonProjectType, error) {
+	direntries, err := os.ReadDir(conf.ProjectPath)
+	if err != nil {
+		return UnknownPython, err
+	}
+
+	foundLockFiles := []string{}
+	projectType := UnknownPython
+	for _, direntry := range direntries {
+		for _, pythonLockFile := range pythonLockFiles {
+			if direntry.Name() == pythonLockFile.LockFile {
+				foundLockFiles = append(foundLockFiles, pythonLockFile.LockFile)
+				projectType = pythonLockFile.ProjectType
+			}
+		}
+	}
+
+	if len(foundLockFiles) > 1 {
+		return UnknownPython, errors.New(fmt.Sprintf("Found %s in the project %s at path %s. Please remove all but one of them", strings.Join(foundLockFiles, " and "), conf.ServiceName, conf.ProjectPath))
+	}
+	if len(foundLockFiles) == 0 {
+		return UnknownPython, errors.New(fmt.Sprintf("Neither requirements.txt, poetry.lock, Pipfile.lock nor uv.lock were found in the project %s at path %s. Please add one of them.", conf.ServiceName, conf.ProjectPath))
+	}
+	return projectType, nil
+}
+
+// getPythonInstallCommands copies the files describing the dependencies and installs them,
+// so the dependencies are cached until the files change.
+func getPythonInstallCommands(projectType PythonProjectType) string {
+	switch projectType {
+	case Pip:
+		return `COPY requirements.txt ./
+			RUN pip install --no-cache-dir -r requirements.txt`
+	case Poetry:
+		return `COPY pyproject.toml poetry.lock ./
+			RUN pip install --no-cache-dir poetry && poetry config virtualenvs.create false && poetry install --no-root --no-interaction --only main`
+	case Pipenv:
+		return `COPY Pipfile Pipfile.lock ./
+			RUN pip install --no-cache-dir pipenv && pipenv install --system --deploy`
+	case Uv:
+		// The environment is created outside the app folder, so the sources copied afterwards cannot replace it.
+		return `COPY pyproject.toml uv.lock ./
+			ENV UV_PROJECT_ENVIRONMENT=/opt/venv
+			RUN pip install --no-cache-dir uv && uv sync --frozen --no-dev --no-install-project
+			ENV PATH="/opt/venv/bin:$PATH"`
+	}
+	return ""
+}
+
+var PythonBuilder = &Builder{
+	BuilderNames: []string{"python"},
+	Config:       PythonBuilderConfig{},
+	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+		builderConfig := &PythonBuilderConfig{}
+		err := json.Unmarshal(conf.Builder, builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if builderConfig.PythonVersion == "" {
+			return nil, errors.New(fmt.Sprintf("No pythonversion given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+		if builderConfig.RunCommand == "" {
+			return nil, errors.New(fmt.Sprintf("No runcommand given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+
+		pythonProjectType, err := GetPythonProjectType(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		dockercontent := fmt.Sprintf(`
+			FROM python:%s-slim
+
+			ENV PYTHONUNBUFFERED=1
+			WORKDIR /usr/src/app
+			%s
+
+			COPY / ./
+
+			CMD %s
+		`, builderConfig.PythonVersion, getPythonInstallCommands(pythonProjectType), builderConfig.RunCommand)
+
+		arguments := &BuildArguments{
+			DockerFileContent: dockercontent,
+			DockerBuildContextPaths: map[string]string{
+				conf.ProjectPath: "",
+			},
+		}
+		if err := writeGeneratedDockerfile(arguments); err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	},
+}
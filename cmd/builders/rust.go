@@ -0,0 +1,304 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/pelletier/go-toml"
+)
+
+type RustBuilderConfig struct {
+	Type      string `json:"type"`
+	Toolchain string `json:"toolchain" required:"true" description:"The rust toolchain version used to build the service, like 1.56 or 1.56.1."`
+	Binary    string `json:"binary" description:"The binary to build and run. Defaults to the name of the package."`
+	Target    string `json:"target" enum:"gnu,musl" description:"Whether the binary is linked against glibc and runs on debian, or against musl and runs on alpine. Defaults to gnu."`
+}
+
+// cargoWorkspace describes the cargo workspace the service is part of. Paths are relative to the working directory.
+type cargoWorkspace struct {
+	RootDir string
+	// Members are the folders of every package in the workspace.
+	Members []string
+}
+
+func loadCargoManifest(dir string) (*toml.Tree, error) {
+	manifest, err := toml.LoadFile(filepath.Join(dir, "Cargo.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", filepath.Join(dir, "Cargo.toml"), err)
+	}
+	return manifest, nil
+}
+
+func getStringsOfTomlArray(value interface{}) []string {
+	items, _ := value.([]interface{})
+	values := []string{}
+	for _, item := range items {
+		if text, ok := item.(string); ok {
+			values = append(values, text)
+		}
+	}
+	return values
+}
+
+// findCargoWorkspace walks up from the project folder to the Cargo.toml with a [workspace] section.
+// A package outside a workspace is a workspace of its own.
+func findCargoWorkspace(projectPath string) (*cargoWorkspace, error) {
+	dir := filepath.Clean(projectPath)
+	for {
+		if fileExists(filepath.Join(dir, "Cargo.toml")) {
+			manifest, err := loadCargoManifest(dir)
+			if err != nil {
+				return nil, err
+			}
+			if manifest.Has("workspace") {
+				return getCargoWorkspaceMembers(dir, manifest)
+			}
+		}
+		if dir == "." || strings.HasPrefix(dir, "..") {
+			return &cargoWorkspace{
+				RootDir: filepath.Clean(projectPath),
+				Members: []string{filepath.Clean(projectPath)},
+			}, nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func getCargoWorkspaceMembers(rootDir string, manifest *toml.Tree) (*cargoWorkspace, error) {
+	excluded := []string{}
+	for _, exclude := range getStringsOfTomlArray(manifest.Get("workspace.exclude")) {
+		excluded = append(excluded, filepath.Join(rootDir, exclude))
+	}
+
+	members := []string{}
+	if manifest.Has("package") {
+		members = append(members, rootDir)
+	}
+	for _, member := range getStringsOfTomlArray(manifest.Get("workspace.members")) {
+		matches, err := filepath.Glob(filepath.Join(rootDir, member))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if fileExists(filepath.Join(match, "Cargo.toml")) && !containsPath(excluded, match) {
+				members = append(members, match)
+			}
+		}
+	}
+	sort.Strings(members)
+	return &cargoWorkspace{
+		RootDir: rootDir,
+		Members: unique(members),
+	}, nil
+}
+
+// getCargoTargetFiles returns the source files cargo expects for the targets of the package, and whether they are binaries.
+// They are replaced by empty sources to build the dependencies before the sources are copied.
+func getCargoTargetFiles(memberDir string) (map[string]bool, error) {
+	manifest, err := loadCargoManifest(memberDir)
+	if err != nil {
+		return nil, err
+	}
+
+	targetFiles := map[string]bool{}
+	if libPath, ok := manifest.Get("lib.path").(string); ok {
+		targetFiles[libPath] = false
+	} else if manifest.Has("lib") || fileExists(filepath.Join(memberDir, "src", "lib.rs")) {
+		targetFiles["src/lib.rs"] = false
+	}
+
+	if fileExists(filepath.Join(memberDir, "src", "main.rs")) {
+		targetFiles["src/main.rs"] = true
+	}
+	// Cargo finds the binaries in src/bin by itself, unless autobins is turned off.
+	if autobins, ok := manifest.Get("package.autobins").(bool); !ok || autobins {
+		for _, pattern := range []string{"*.rs", filepath.Join("*", "main.rs")} {
+			matches, err := filepath.Glob(filepath.Join(memberDir, "src", "bin", pattern))
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range matches {
+				relativePath, err := filepath.Rel(memberDir, match)
+				if err != nil {
+					return nil, err
+				}
+				targetFiles[filepath.ToSlash(relativePath)] = true
+			}
+		}
+	}
+	if bins, ok := manifest.Get("bin").([]*toml.Tree); ok {
+		for _, bin := range bins {
+			if binPath, ok := bin.Get("path").(string); ok {
+				targetFiles[binPath] = true
+			} else if name, ok := bin.Get("name").(string); ok && !fileExists(filepath.Join(memberDir, "src", "main.rs")) {
+				targetFiles[path.Join("src", "bin", name+".rs")] = true
+			}
+		}
+	}
+
+	if buildScript, ok := manifest.Get("package.build").(string); ok {
+		targetFiles[buildScript] = true
+	} else if fileExists(filepath.Join(memberDir, "build.rs")) {
+		targetFiles["build.rs"] = true
+	}
+	return targetFiles, nil
+}
+
+func getCargoDummySourceCommands(workspace *cargoWorkspace) (string, error) {
+	commands := []string{}
+	for _, member := range workspace.Members {
+		targetFiles, err := getCargoTargetFiles(member)
+		if err != nil {
+			return "", err
+		}
+		files := make([]string, 0, len(targetFiles))
+		for file := range targetFiles {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			dummyPath := path.Join(DockerSrc, filepath.ToSlash(member), file)
+			content := ""
+			if targetFiles[file] {
+				content = "fn main() {}"
+			}
+			commands = append(commands, fmt.Sprintf("RUN mkdir -p %s && echo '%s' > %s", path.Dir(dummyPath), content, dummyPath))
+		}
+	}
+	return strings.Join(commands, "\n"), nil
+}
+
+// rustImages are the images of the build and runtime stages for a target, and the commands preparing them.
+type rustImages struct {
+	Build        string
+	BuildSetup   string
+	Runtime      string
+	RuntimeSetup string
+}
+
+func getRustImages(builderConfig *RustBuilderConfig) (*rustImages, error) {
+	switch builderConfig.Target {
+	case "", "gnu":
+		return &rustImages{
+			Build:        fmt.Sprintf("rust:%s-slim-bookworm", builderConfig.Toolchain),
+			Runtime:      "debian:bookworm-slim",
+			RuntimeSetup: "RUN apt-get update && apt-get install -y --no-install-recommends ca-certificates && rm -rf /var/lib/apt/lists/*",
+		}, nil
+	case "musl":
+		return &rustImages{
+			Build:        fmt.Sprintf("rust:%s-alpine", builderConfig.Toolchain),
+			BuildSetup:   "RUN apk add --no-cache musl-dev",
+			Runtime:      "alpine:3",
+			RuntimeSetup: "RUN apk add --no-cache ca-certificates",
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid target value. given %s", builderConfig.Target)
+}
+
+var RustBuilder = &Builder{
+	BuilderNames: []string{"rust"},
+	Config:       RustBuilderConfig{},
+	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+		builderConfig := &RustBuilderConfig{}
+		err := json.Unmarshal(conf.Builder, builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if builderConfig.Toolchain == "" {
+			return nil, errors.New(fmt.Sprintf("No toolchain given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+
+		images, err := getRustImages(builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fileExists(filepath.Join(conf.ProjectPath, "Cargo.toml")) {
+			return nil, errors.New(fmt.Sprintf("No Cargo.toml found in the project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+		manifest, err := loadCargoManifest(conf.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+		packageName, ok := manifest.Get("package.name").(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("The Cargo.toml of the project %s at path %s has no package name", conf.ServiceName, conf.ProjectPath))
+		}
+		binary := builderConfig.Binary
+		if binary == "" {
+			binary = packageName
+		}
+
+		workspace, err := findCargoWorkspace(conf.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		manifestFiles := []string{filepath.Join(workspace.RootDir, "Cargo.toml")}
+		lockedFlag := ""
+		if fileExists(filepath.Join(workspace.RootDir, "Cargo.lock")) {
+			manifestFiles = append(manifestFiles, filepath.Join(workspace.RootDir, "Cargo.lock"))
+			lockedFlag = " --locked"
+		}
+		for _, member := range workspace.Members {
+			manifestFiles = append(manifestFiles, filepath.Join(member, "Cargo.toml"))
+		}
+		manifestFiles = unique(manifestFiles)
+
+		dummySources, err := getCargoDummySourceCommands(workspace)
+		if err != nil {
+			return nil, err
+		}
+
+		workspaceDir := path.Join(DockerSrc, filepath.ToSlash(workspace.RootDir))
+		memberDirs := []string{}
+		for _, member := range workspace.Members {
+			memberDirs = append(memberDirs, path.Join(DockerSrc, filepath.ToSlash(member)))
+		}
+
+		buildCommand := fmt.Sprintf("cargo build --release%s -p %s --bin %s", lockedFlag, packageName, binary)
+
+		dockercontent := fmt.Sprintf(`
+			FROM %s AS build-env
+			%s
+
+			# Copy the manifests and build the dependencies with empty sources as a distinct layer
+			%s
+			%s
+			WORKDIR %s
+			RUN %s
+
+			# Copy the sources and build. The sources are touched to be newer than the build of the empty sources
+			%s
+			RUN find %s -name '*.rs' -exec touch {} +
+			RUN %s
+
+			# Build runtime image
+			FROM %s
+			%s
+			COPY --from=build-env %s /usr/local/bin/service
+			ENTRYPOINT ["/usr/local/bin/service"]
+		`, images.Build, images.BuildSetup, getDockerCopyCommandForDependency(manifestFiles), dummySources, workspaceDir, buildCommand,
+			getDockerCopyCommandForDependency(workspace.Members), strings.Join(memberDirs, " "), buildCommand,
+			images.Runtime, images.RuntimeSetup, path.Join(workspaceDir, "target", "release", binary))
+
+		sourcePaths := append(workspace.Members, manifestFiles...)
+		arguments := &BuildArguments{
+			DockerFileContent:       dockercontent,
+			SourcePaths:             sourcePaths,
+			DockerBuildContextPaths: getContextPathsInPlace(sourcePaths),
+		}
+		if err := writeGeneratedDockerfile(arguments); err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	},
+}
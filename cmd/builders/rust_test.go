@@ -0,0 +1,32 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCargoTargetFilesFindsTheBinariesInSrcBin(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{
+		"Cargo.toml":               "[package]\nname = \"cli\"\n",
+		"src/main.rs":              "fn main() {}\n",
+		"src/lib.rs":               "\n",
+		"src/bin/tool.rs":          "fn main() {}\n",
+		"src/bin/server/main.rs":   "fn main() {}\n",
+		"src/bin/server/routes.rs": "\n",
+	})
+
+	targetFiles, err := getCargoTargetFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"src/lib.rs":             false,
+		"src/main.rs":            true,
+		"src/bin/tool.rs":        true,
+		"src/bin/server/main.rs": true,
+	}
+	if !reflect.DeepEqual(targetFiles, expected) {
+		t.Errorf("expected the target files %v, got %v", expected, targetFiles)
+	}
+}
@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+type StaticBuilderConfig struct {
+	Type         string `json:"type"`
+	NodeVersion  string `json:"nodeversion" required:"true" description:"The node version used to build the site, like 12 or 12.14.1."`
+	BuildCommand string `json:"buildcommand" required:"true" description:"The command building the site, like npm run build."`
+	OutputDir    string `json:"outputdir" required:"true" description:"The folder the build command writes the site to, relative to the config file. Like dist or build."`
+	Server       string `json:"server" enum:"nginx,caddy" description:"The web server serving the site. Defaults to nginx."`
+}
+
+// staticServerConfigFile is the name of the generated web server config in the build context.
+const staticServerConfigFile = "docker-builder-static.conf"
+
+// The generated configs serve index.html for every path that is not a file, so the routing of the SPA works on reload.
+// Assets get a long cache lifetime as the bundlers put a hash in their names, while index.html must always be revalidated.
+const nginxStaticConfig = `server {
+    listen 80;
+    root /usr/share/nginx/html;
+    index index.html;
+
+    location / {
+        try_files $uri $uri/ /index.html;
+        add_header Cache-Control "no-cache";
+    }
+
+    location ~* \.(?:js|mjs|css|map|png|jpe?g|gif|svg|ico|webp|avif|woff2?|ttf|eot)$ {
+        try_files $uri =404;
+        add_header Cache-Control "public, max-age=31536000, immutable";
+    }
+}
+`
+
+const caddyStaticConfig = `:80 {
+	root * /usr/share/caddy
+	encode gzip
+
+	@assets path *.js *.mjs *.css *.map *.png *.jpg *.jpeg *.gif *.svg *.ico *.webp *.avif *.woff *.woff2 *.ttf *.eot
+	@pages not path *.js *.mjs *.css *.map *.png *.jpg *.jpeg *.gif *.svg *.ico *.webp *.avif *.woff *.woff2 *.ttf *.eot
+	header @assets Cache-Control "public, max-age=31536000, immutable"
+	header @pages Cache-Control "no-cache"
+
+	try_files {path} /index.html
+	file_server
+}
+`
+
+// getStaticServerStage returns the runtime stage serving the site from the given folder of the build stage.
+func getStaticServerStage(server string, sitePath string) (string, string, error) {
+	switch server {
+	case "", "nginx":
+		return fmt.Sprintf(`FROM nginx:stable-alpine
+			COPY %s /etc/nginx/conf.d/default.conf
+			COPY --from=build-env %s /usr/share/nginx/html`, staticServerConfigFile, sitePath), nginxStaticConfig, nil
+	case "caddy":
+		return fmt.Sprintf(`FROM caddy:2-alpine
+			COPY %s /etc/caddy/Caddyfile
+			COPY --from=build-env %s /usr/share/caddy`, staticServerConfigFile, sitePath), caddyStaticConfig, nil
+	}
+	return "", "", fmt.Errorf("invalid server value. given %s", server)
+}
+
+var StaticBuilder = &Builder{
+	BuilderNames: []string{"static"},
+	Config:       StaticBuilderConfig{},
+	GetBuildArguments: func(conf structs.ConfigurationWithProjectPath) (*BuildArguments, error) {
+		builderConfig := &StaticBuilderConfig{}
+		err := json.Unmarshal(conf.Builder, builderConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if builderConfig.BuildCommand == "" {
+			return nil, errors.New(fmt.Sprintf("No buildcommand given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+		if builderConfig.OutputDir == "" {
+			return nil, errors.New(fmt.Sprintf("No outputdir given in project %s at path %s", conf.ServiceName, conf.ProjectPath))
+		}
+
+		project, err := getNodeProject(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		installCommands, err := project.getInstallCommands()
+		if err != nil {
+			return nil, err
+		}
+		copySources, err := project.getSourcesCopyCommand()
+		if err != nil {
+			return nil, err
+		}
+		serviceDir, err := project.getServiceDir(conf.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		serverStage, serverConfig, err := getStaticServerStage(builderConfig.Server, path.Join(serviceDir, builderConfig.OutputDir))
+		if err != nil {
+			return nil, err
+		}
+
+		dockercontent := fmt.Sprintf(`
+			FROM node:%s-alpine AS build-env
+
+			WORKDIR /usr/src/app
+			%s
+
+			%s
+
+			WORKDIR %s
+			RUN %s
+
+			# Build runtime image
+			%s
+		`, builderConfig.NodeVersion, installCommands, copySources, serviceDir, builderConfig.BuildCommand, serverStage)
+
+		arguments, err := project.getBuildArguments(dockercontent, map[string]string{
+			staticServerConfigFile: serverConfig,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return arguments, nil
+	},
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	viper.SetDefault("clusters", []string{"controller", "services"})
+}
+
+// getAllowedClusters returns the clusters given by the clusters key in the global config.
+func getAllowedClusters() []string {
+	return viper.GetStringSlice("clusters")
+}
+
+func isAllowedCluster(cluster string) bool {
+	for _, allowedCluster := range getAllowedClusters() {
+		if allowedCluster == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// validateClusterNames checks the clusters given with the --cluster flag.
+// The default cluster holds the services without a cluster, and can always be selected.
+func validateClusterNames(clusters []string) error {
+	for _, cluster := range clusters {
+		if cluster != defaultCluster && !isAllowedCluster(cluster) {
+			return fmt.Errorf("unknown cluster %s. Allowed clusters are %s", cluster, strings.Join(getAllowedClusters(), ", "))
+		}
+	}
+	return nil
+}
+
+func isClusterSelected(cluster string, selectedClusters []string) bool {
+	if len(selectedClusters) == 0 {
+		return true
+	}
+	for _, selectedCluster := range selectedClusters {
+		if selectedCluster == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+func filterConfigurationsByCluster(configurations []structs.ConfigurationWithProjectPath, selectedClusters []string) []structs.ConfigurationWithProjectPath {
+	filtered := []structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		if isClusterSelected(getClusterName(configuration), selectedClusters) {
+			filtered = append(filtered, configuration)
+		}
+	}
+	return filtered
+}
+
+// getSortedClusters returns the keys of a map grouped by cluster in a stable order.
+func getSortedClusters(clusters map[string]int) []string {
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	viper.SetDefault("configname", "ytbdsettings")
+}
+
+var configFileExtensions = []string{".json", ".yaml", ".yml"}
+
+// getConfigFileNames returns the names a service config file can have, given by the configname key in the global config.
+func getConfigFileNames() []string {
+	configName := viper.GetString("configname")
+	names := []string{}
+	for _, extension := range configFileExtensions {
+		names = append(names, configName+extension)
+	}
+	return names
+}
+
+func isConfigFileName(name string) bool {
+	return containsString(getConfigFileNames(), name)
+}
+
+// parseConfigFile parses a json, jsonc or yaml config file into a tree of configNodes.
+func parseConfigFile(file string, content []byte) (*configNode, error) {
+	var node *configNode
+	var err error
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		node, err = parseYAMLConfig(content)
+	default:
+		node, err = parseJSONConfig(content)
+	}
+
+	if syntaxErr, ok := err.(*configSyntaxError); ok {
+		return nil, &validationError{File: file, Line: syntaxErr.Line, Column: syntaxErr.Column, Message: syntaxErr.Message}
+	}
+	if err != nil {
+		return nil, err
+	}
+	node.setFile(file)
+	return node, nil
+}
+
+func readConfigFile(file string) (*configNode, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigFile(file, content)
+}
+
+// decodeConfiguration converts a parsed config file to a structs.Configuration.
+func decodeConfiguration(node *configNode) (structs.Configuration, error) {
+	configuration := structs.Configuration{}
+	content, err := json.Marshal(node.toValue())
+	if err != nil {
+		return configuration, err
+	}
+	err = json.Unmarshal(content, &configuration)
+	return configuration, err
+}
+
+// yamlErrorLine matches the line yaml reports syntax errors at, like yaml: line 3: mapping values are not allowed in this context.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// getYAMLSyntaxError returns the syntax error at the line reported by yaml, which does not report the column.
+func getYAMLSyntaxError(err error) *configSyntaxError {
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return &configSyntaxError{Line: line, Column: 1, Message: match[2]}
+	}
+	return &configSyntaxError{Line: 1, Column: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+func parseYAMLConfig(content []byte) (*configNode, error) {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, getYAMLSyntaxError(err)
+	}
+	if len(document.Content) == 0 {
+		return nil, &configSyntaxError{Line: 1, Column: 1, Message: "the config is empty"}
+	}
+	return convertYAMLNode(document.Content[0])
+}
+
+func convertYAMLNode(node *yaml.Node) (*configNode, error) {
+	converted := &configNode{
+		Line:   node.Line,
+		Column: node.Column,
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return convertYAMLNode(node.Alias)
+	case yaml.MappingNode:
+		converted.Kind = objectNode
+		converted.Fields = map[string]*configNode{}
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key, err := convertYAMLNode(node.Content[index])
+			if err != nil {
+				return nil, err
+			}
+			keyName := node.Content[index].Value
+			key.Kind = stringNode
+			key.Value = keyName
+			if _, found := converted.Fields[keyName]; found {
+				return nil, &configSyntaxError{Line: key.Line, Column: key.Column, Message: fmt.Sprintf("duplicate key %q", keyName)}
+			}
+			value, err := convertYAMLNode(node.Content[index+1])
+			if err != nil {
+				return nil, err
+			}
+			converted.Keys = append(converted.Keys, key)
+			converted.Fields[keyName] = value
+		}
+	case yaml.SequenceNode:
+		converted.Kind = arrayNode
+		for _, item := range node.Content {
+			convertedItem, err := convertYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+			converted.Items = append(converted.Items, convertedItem)
+		}
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			converted.Kind = nullNode
+		case "!!bool":
+			var value bool
+			if err := node.Decode(&value); err != nil {
+				return nil, &configSyntaxError{Line: node.Line, Column: node.Column, Message: err.Error()}
+			}
+			converted.Kind = boolNode
+			converted.Value = value
+			converted.Text = node.Value
+		case "!!int", "!!float":
+			var value float64
+			if err := node.Decode(&value); err != nil {
+				return nil, &configSyntaxError{Line: node.Line, Column: node.Column, Message: err.Error()}
+			}
+			converted.Kind = numberNode
+			converted.Value = value
+			converted.Text = node.Value
+		default:
+			converted.Kind = stringNode
+			converted.Value = node.Value
+		}
+	default:
+		return nil, &configSyntaxError{Line: node.Line, Column: node.Column, Message: "unsupported yaml node"}
+	}
+	return converted, nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestConvertScalarsToStringsKeepsTheSourceText(t *testing.T) {
+	tests := map[string]string{
+		"ytbdsettings.yaml": "servicename: api\nbuilder:\n  type: go\n  goversion: 1.20\n  cgo: true\n",
+		"ytbdsettings.json": `{"servicename": "api", "builder": {"type": "go", "goversion": 1.20, "cgo": true}}`,
+	}
+
+	for file, content := range tests {
+		t.Run(file, func(t *testing.T) {
+			node, err := parseConfigFile(file, []byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			convertScalarsToStrings(node)
+
+			if errs := validateConfigurationNode(file, node); len(errs) > 0 {
+				t.Fatalf("expected the config to be valid, got %v", errs)
+			}
+			goVersion := node.Fields["builder"].Fields["goversion"]
+			if goVersion.Kind != stringNode || goVersion.Value != "1.20" {
+				t.Errorf("expected goversion to be the string 1.20, got the %s %v", goVersion.Kind, goVersion.Value)
+			}
+			if cgo := node.Fields["builder"].Fields["cgo"]; cgo.Kind != boolNode || cgo.Value != true {
+				t.Errorf("expected cgo to stay a boolean, got the %s %v", cgo.Kind, cgo.Value)
+			}
+		})
+	}
+}
+
+func TestParseYAMLConfigRemembersPositions(t *testing.T) {
+	node, err := parseConfigFile("ytbdsettings.yaml", []byte("servicename: api\nbuilder:\n  type: nodejs\n  nodeversion: 14\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeVersion := node.Fields["builder"].Fields["nodeversion"]
+	if nodeVersion.position() != "ytbdsettings.yaml:4:16" {
+		t.Errorf("expected nodeversion at ytbdsettings.yaml:4:16, got %s", nodeVersion.position())
+	}
+	if nodeVersion.Text != "14" {
+		t.Errorf("expected the source text 14, got %q", nodeVersion.Text)
+	}
+}
+
+func TestParseYAMLConfigReportsTheLineOfSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"mapping in a value", "servicename: api\nbuilder:\n  type: go: 1\n", "ytbdsettings.yaml:3:1: mapping values are not allowed in this context"},
+		{"tab indentation", "servicename: api\nbuilder:\n\ttype: go\n", "ytbdsettings.yaml:3:1: found character that cannot start any token"},
+		{"empty", "", "ytbdsettings.yaml:1:1: the config is empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseConfigFile("ytbdsettings.yaml", []byte(test.content))
+			if err == nil {
+				t.Fatalf("expected the error %q", test.message)
+			}
+			if err.Error() != test.message {
+				t.Errorf("expected the error %q, got %q", test.message, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type configNodeKind string
+
+const (
+	objectNode configNodeKind = "object"
+	arrayNode  configNodeKind = "array"
+	stringNode configNodeKind = "string"
+	numberNode configNodeKind = "number"
+	boolNode   configNodeKind = "boolean"
+	nullNode   configNodeKind = "null"
+)
+
+// configNode is a parsed config file value that remembers where in the file it was found,
+// so validation errors can point at the offending line and column.
+type configNode struct {
+	Kind configNodeKind
+	// File is where the value was given. Values without a Line come from somewhere else than a config file.
+	File   string
+	Line   int
+	Column int
+	// Keys holds the keys of an object in the order they were given.
+	Keys []*configNode
+	// Fields holds the values of an object by key.
+	Fields map[string]*configNode
+	Items  []*configNode
+	Value  interface{}
+	// Text is the source text of a number or boolean. It is the value of fields expecting a string,
+	// so versions given unquoted, like goversion: 1.20, are not read as numbers.
+	Text string
+}
+
+func (n *configNode) field(key string) (*configNode, bool) {
+	if n.Kind != objectNode {
+		return nil, false
+	}
+	value, found := n.Fields[key]
+	return value, found
+}
+
+// position describes where the value was given, as file:line:column when it is known.
+func (n *configNode) position() string {
+	if n.Line == 0 {
+		return n.File
+	}
+	return fmt.Sprintf("%s:%d:%d", n.File, n.Line, n.Column)
+}
+
+// setFile sets the file of the node and every node below it.
+func (n *configNode) setFile(file string) {
+	n.File = file
+	for _, key := range n.Keys {
+		key.setFile(file)
+	}
+	for _, value := range n.Fields {
+		value.setFile(file)
+	}
+	for _, item := range n.Items {
+		item.setFile(file)
+	}
+}
+
+// toValue converts the node to the value encoding/json would decode it to.
+func (n *configNode) toValue() interface{} {
+	switch n.Kind {
+	case objectNode:
+		object := map[string]interface{}{}
+		for key, value := range n.Fields {
+			object[key] = value.toValue()
+		}
+		return object
+	case arrayNode:
+		array := []interface{}{}
+		for _, item := range n.Items {
+			array = append(array, item.toValue())
+		}
+		return array
+	}
+	return n.Value
+}
+
+type configSyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *configSyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type jsonConfigParser struct {
+	content []byte
+	offset  int
+	line    int
+	column  int
+}
+
+// parseJSONConfig parses a json config file into a tree of configNodes.
+// Like jsonc, // and /* */ comments and trailing commas are allowed.
+func parseJSONConfig(content []byte) (*configNode, error) {
+	parser := &jsonConfigParser{
+		content: content,
+		line:    1,
+		column:  1,
+	}
+
+	node, err := parser.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parser.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if parser.offset < len(parser.content) {
+		return nil, parser.errorf("unexpected %q after the end of the config", parser.content[parser.offset])
+	}
+	return node, nil
+}
+
+func (p *jsonConfigParser) errorf(format string, args ...interface{}) error {
+	return &configSyntaxError{
+		Line:    p.line,
+		Column:  p.column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *jsonConfigParser) advance() {
+	r, size := utf8.DecodeRune(p.content[p.offset:])
+	p.offset += size
+	if r == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+}
+
+// skipWhitespace skips the whitespace and comments before the next token.
+func (p *jsonConfigParser) skipWhitespace() error {
+	for p.offset < len(p.content) {
+		switch {
+		case strings.IndexByte(" \t\r\n", p.content[p.offset]) >= 0:
+			p.advance()
+		case p.hasPrefix("//"):
+			for p.offset < len(p.content) && p.content[p.offset] != '\n' {
+				p.advance()
+			}
+		case p.hasPrefix("/*"):
+			line, column := p.line, p.column
+			p.advance()
+			p.advance()
+			for p.offset < len(p.content) && !p.hasPrefix("*/") {
+				p.advance()
+			}
+			if p.offset >= len(p.content) {
+				return &configSyntaxError{Line: line, Column: column, Message: "unterminated comment"}
+			}
+			p.advance()
+			p.advance()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *jsonConfigParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(p.content[p.offset:]), prefix)
+}
+
+func (p *jsonConfigParser) newNode(kind configNodeKind) *configNode {
+	return &configNode{
+		Kind:   kind,
+		Line:   p.line,
+		Column: p.column,
+	}
+}
+
+func (p *jsonConfigParser) expect(expected byte) error {
+	if err := p.skipWhitespace(); err != nil {
+		return err
+	}
+	if p.offset >= len(p.content) {
+		return p.errorf("expected %q but the config ended", expected)
+	}
+	if p.content[p.offset] != expected {
+		return p.errorf("expected %q but found %q", expected, p.content[p.offset])
+	}
+	p.advance()
+	return nil
+}
+
+func (p *jsonConfigParser) parseValue() (*configNode, error) {
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.offset >= len(p.content) {
+		return nil, p.errorf("expected a value but the config ended")
+	}
+
+	switch character := p.content[p.offset]; {
+	case character == '{':
+		return p.parseObject()
+	case character == '[':
+		return p.parseArray()
+	case character == '"':
+		return p.parseString()
+	case character == '-' || (character >= '0' && character <= '9'):
+		return p.parseNumber()
+	default:
+		return p.parseLiteral()
+	}
+}
+
+func (p *jsonConfigParser) parseObject() (*configNode, error) {
+	node := p.newNode(objectNode)
+	node.Fields = map[string]*configNode{}
+	p.advance()
+
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.offset < len(p.content) && p.content[p.offset] == '}' {
+		p.advance()
+		return node, nil
+	}
+
+	for {
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.offset < len(p.content) && p.content[p.offset] == '}' {
+			// A trailing comma after the last key.
+			p.advance()
+			return node, nil
+		}
+		if p.offset >= len(p.content) || p.content[p.offset] != '"' {
+			return nil, p.errorf("expected a quoted key")
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		keyName := key.Value.(string)
+		if _, found := node.Fields[keyName]; found {
+			return nil, &configSyntaxError{Line: key.Line, Column: key.Column, Message: fmt.Sprintf("duplicate key %q", keyName)}
+		}
+
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		node.Keys = append(node.Keys, key)
+		node.Fields[keyName] = value
+
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.offset >= len(p.content) {
+			return nil, p.errorf("expected ',' or '}' but the config ended")
+		}
+		if p.content[p.offset] == '}' {
+			p.advance()
+			return node, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsonConfigParser) parseArray() (*configNode, error) {
+	node := p.newNode(arrayNode)
+	p.advance()
+
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.offset < len(p.content) && p.content[p.offset] == ']' {
+		p.advance()
+		return node, nil
+	}
+
+	for {
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.offset < len(p.content) && p.content[p.offset] == ']' {
+			// A trailing comma after the last item.
+			p.advance()
+			return node, nil
+		}
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		node.Items = append(node.Items, item)
+
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.offset >= len(p.content) {
+			return nil, p.errorf("expected ',' or ']' but the config ended")
+		}
+		if p.content[p.offset] == ']' {
+			p.advance()
+			return node, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsonConfigParser) parseString() (*configNode, error) {
+	node := p.newNode(stringNode)
+	start := p.offset
+	p.advance()
+
+	for p.offset < len(p.content) {
+		switch p.content[p.offset] {
+		case '\\':
+			p.advance()
+			if p.offset >= len(p.content) {
+				return nil, p.errorf("unterminated string")
+			}
+			p.advance()
+		case '"':
+			p.advance()
+			// Go does not know the \/ escape allowed by json.
+			value, err := strconv.Unquote(strings.ReplaceAll(string(p.content[start:p.offset]), `\/`, "/"))
+			if err != nil {
+				return nil, &configSyntaxError{Line: node.Line, Column: node.Column, Message: "invalid string"}
+			}
+			node.Value = value
+			return node, nil
+		case '\n':
+			return nil, p.errorf("unterminated string")
+		default:
+			p.advance()
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *jsonConfigParser) parseNumber() (*configNode, error) {
+	node := p.newNode(numberNode)
+	start := p.offset
+	for p.offset < len(p.content) && strings.IndexByte("+-0123456789.eE", p.content[p.offset]) >= 0 {
+		p.advance()
+	}
+
+	value, err := strconv.ParseFloat(string(p.content[start:p.offset]), 64)
+	if err != nil {
+		return nil, &configSyntaxError{Line: node.Line, Column: node.Column, Message: fmt.Sprintf("invalid number %s", p.content[start:p.offset])}
+	}
+	node.Value = value
+	node.Text = string(p.content[start:p.offset])
+	return node, nil
+}
+
+func (p *jsonConfigParser) parseLiteral() (*configNode, error) {
+	literals := []struct {
+		text  string
+		kind  configNodeKind
+		value interface{}
+	}{
+		{"true", boolNode, true},
+		{"false", boolNode, false},
+		{"null", nullNode, nil},
+	}
+
+	for _, literal := range literals {
+		if strings.HasPrefix(string(p.content[p.offset:]), literal.text) {
+			node := p.newNode(literal.kind)
+			node.Value = literal.value
+			if literal.kind == boolNode {
+				node.Text = literal.text
+			}
+			for range literal.text {
+				p.advance()
+			}
+			return node, nil
+		}
+	}
+
+	return nil, p.errorf("unexpected %q", p.content[p.offset])
+}
+
+// getJSONValueSpan returns the offsets of the start and the end of the value found at the line and column.
+func getJSONValueSpan(content []byte, line int, column int) (int, int, error) {
+	parser := &jsonConfigParser{
+		content: content,
+		line:    1,
+		column:  1,
+	}
+	for parser.offset < len(parser.content) && (parser.line < line || (parser.line == line && parser.column < column)) {
+		parser.advance()
+	}
+
+	start := parser.offset
+	if _, err := parser.parseValue(); err != nil {
+		return 0, 0, err
+	}
+	return start, parser.offset, nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONConfigAllowsCommentsAndTrailingCommas(t *testing.T) {
+	content := `// The service
+{
+    "servicename": "api", /* inline */
+    "replicas": 2,
+    "builder": {
+        "type": "nodejs", // trailing comment
+        "args": ["a", "b\/c",],
+    },
+    "enabled": true,
+    "deploy": null,
+}
+/* the end */
+`
+	node, err := parseJSONConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"servicename": "api",
+		"replicas":    float64(2),
+		"builder": map[string]interface{}{
+			"type": "nodejs",
+			"args": []interface{}{"a", "b/c"},
+		},
+		"enabled": true,
+		"deploy":  nil,
+	}
+	if value := node.toValue(); !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+
+	keys := []string{}
+	for _, key := range node.Keys {
+		keys = append(keys, key.Value.(string))
+	}
+	if !reflect.DeepEqual(keys, []string{"servicename", "replicas", "builder", "enabled", "deploy"}) {
+		t.Errorf("expected the keys in the order they were given, got %v", keys)
+	}
+}
+
+func TestParseJSONConfigRemembersPositions(t *testing.T) {
+	content := "{\n  \"servicename\": \"api\",\n  \"builder\": {\n    \"type\": \"go\"\n  }\n}"
+	node, err := parseJSONConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servicename := node.Fields["servicename"]
+	if servicename.Line != 2 || servicename.Column != 18 {
+		t.Errorf("expected servicename at 2:18, got %d:%d", servicename.Line, servicename.Column)
+	}
+	builderType := node.Fields["builder"].Fields["type"]
+	if builderType.Line != 4 || builderType.Column != 13 {
+		t.Errorf("expected the builder type at 4:13, got %d:%d", builderType.Line, builderType.Column)
+	}
+	if key := node.Keys[1]; key.Line != 3 || key.Column != 3 {
+		t.Errorf("expected the builder key at 3:3, got %d:%d", key.Line, key.Column)
+	}
+}
+
+func TestParseJSONConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"unterminated comment", "{\n  /* servicename\n  \"servicename\": \"api\"\n}", "2:3: unterminated comment"},
+		{"unterminated comment after the config", "{}\n/*", "2:1: unterminated comment"},
+		{"comment closed by its own opening", "{} /*/", "1:4: unterminated comment"},
+		{"unterminated string", "{\"servicename\": \"api\n}", "1:21: unterminated string"},
+		{"duplicate key", "{\"a\": 1,\n \"a\": 2}", "2:2: duplicate key \"a\""},
+		{"missing comma", "{\"a\": 1 \"b\": 2}", "1:9: expected ',' but found '\"'"},
+		{"unquoted key", "{a: 1}", "1:2: expected a quoted key"},
+		{"invalid number", "{\"a\": 1.2.3}", "1:7: invalid number 1.2.3"},
+		{"unknown literal", "{\"a\": yes}", "1:7: unexpected 'y'"},
+		{"content after the config", "{} {}", "1:4: unexpected '{' after the end of the config"},
+		{"config ended", "{\"a\": ", "1:7: expected a value but the config ended"},
+		{"empty", "", "1:1: expected a value but the config ended"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseJSONConfig([]byte(test.content))
+			if err == nil {
+				t.Fatalf("expected the error %q", test.message)
+			}
+			if err.Error() != test.message {
+				t.Errorf("expected the error %q, got %q", test.message, err.Error())
+			}
+		})
+	}
+}
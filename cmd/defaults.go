@@ -0,0 +1,168 @@
+package cmd
+
+import "os"
+
+// readResolvedConfigFile reads a service config file and merges it on top of the defaults in the repository config file.
+// Values given by the service take precedence over the cluster defaults, which take precedence over the builder defaults.
+func readResolvedConfigFile(file string) (*configNode, error) {
+	node, err := readConfigFile(file)
+	if err != nil || node.Kind != objectNode {
+		return node, err
+	}
+	resolved := applyRepositoryDefaults(node)
+	convertScalarsToStrings(resolved)
+	return resolved, nil
+}
+
+// repositoryConfig is the parsed repository config file, or nil when the working directory has none.
+// It is parsed like the service config files, so the defaults keep their source text and position.
+var repositoryConfig *configNode
+
+// loadRepositoryConfig parses the repository config file when it exists.
+func loadRepositoryConfig(file string) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		repositoryConfig = nil
+		return nil
+	}
+	node, err := readConfigFile(file)
+	if err != nil {
+		return err
+	}
+	repositoryConfig = node
+	return nil
+}
+
+// getRepositoryDefaults returns the object at the path below defaults in the repository config file, like builders.nodejs.
+func getRepositoryDefaults(names ...string) (*configNode, bool) {
+	if repositoryConfig == nil {
+		return nil, false
+	}
+	node, found := repositoryConfig.field("defaults")
+	for _, name := range names {
+		if !found {
+			return nil, false
+		}
+		node, found = node.field(name)
+	}
+	if !found || node.Kind != objectNode || len(node.Keys) == 0 {
+		return nil, false
+	}
+	return node, true
+}
+
+func applyRepositoryDefaults(node *configNode) *configNode {
+	cluster := ""
+	if clusterNode, found := node.field("cluster"); found && clusterNode.Kind == stringNode {
+		cluster = clusterNode.Value.(string)
+	}
+
+	resolved := node
+	if cluster != "" {
+		if clusterDefaultsNode, found := getRepositoryDefaults("clusters", cluster); found {
+			// A builder of another type in the config file replaces the builder of the cluster, instead of being merged with it.
+			if builderType := getBuilderTypeOfNode(node); builderType != "" && builderType != getBuilderTypeOfNode(clusterDefaultsNode) {
+				clusterDefaultsNode = withoutField(clusterDefaultsNode, "builder")
+			}
+			resolved = mergeConfigNodes(clusterDefaultsNode, resolved)
+		}
+	}
+
+	builderType := getBuilderTypeOfNode(resolved)
+	if builderType == "" {
+		builderType = "manual"
+	}
+
+	if builderDefaults, found := getRepositoryDefaults("builders", builderType); found {
+		builderDefaultsNode := &configNode{
+			Kind:   objectNode,
+			File:   builderDefaults.File,
+			Keys:   []*configNode{{Kind: stringNode, File: builderDefaults.File, Value: "builder"}},
+			Fields: map[string]*configNode{"builder": builderDefaults},
+		}
+		resolved = mergeConfigNodes(builderDefaultsNode, resolved)
+	}
+	return resolved
+}
+
+// getBuilderTypeOfNode returns the builder type given in the config, or an empty string when it is not given.
+func getBuilderTypeOfNode(node *configNode) string {
+	if builderNode, found := node.field("builder"); found {
+		if typeNode, found := builderNode.field("type"); found && typeNode.Kind == stringNode {
+			return typeNode.Value.(string)
+		}
+	}
+	return ""
+}
+
+func withoutField(node *configNode, name string) *configNode {
+	copied := *node
+	copied.Keys = []*configNode{}
+	copied.Fields = map[string]*configNode{}
+	for _, key := range node.Keys {
+		if key.Value.(string) != name {
+			copied.Keys = append(copied.Keys, key)
+			copied.Fields[key.Value.(string)] = node.Fields[key.Value.(string)]
+		}
+	}
+	return &copied
+}
+
+// mergeConfigNodes deep merges the objects, where the values of override take precedence.
+func mergeConfigNodes(base *configNode, override *configNode) *configNode {
+	if base.Kind != objectNode || override.Kind != objectNode {
+		return override
+	}
+
+	merged := &configNode{
+		Kind:   objectNode,
+		File:   override.File,
+		Line:   override.Line,
+		Column: override.Column,
+		Fields: map[string]*configNode{},
+	}
+	for _, key := range base.Keys {
+		name := key.Value.(string)
+		if _, found := override.Fields[name]; found {
+			continue
+		}
+		merged.Keys = append(merged.Keys, key)
+		merged.Fields[name] = base.Fields[name]
+	}
+	for _, key := range override.Keys {
+		name := key.Value.(string)
+		merged.Keys = append(merged.Keys, key)
+		if baseValue, found := base.Fields[name]; found {
+			merged.Fields[name] = mergeConfigNodes(baseValue, override.Fields[name])
+		} else {
+			merged.Fields[name] = override.Fields[name]
+		}
+	}
+	return merged
+}
+
+type resolvedValue struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// getResolvedValues flattens the resolved config to its values and where each of them came from.
+func getResolvedValues(node *configNode, prefix string) []resolvedValue {
+	if node.Kind != objectNode {
+		return []resolvedValue{{
+			Key:    prefix,
+			Value:  node.toValue(),
+			Source: node.position(),
+		}}
+	}
+
+	values := []resolvedValue{}
+	for _, key := range node.Keys {
+		name := key.Value.(string)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		values = append(values, getResolvedValues(node.Fields[key.Value.(string)], name)...)
+	}
+	return values
+}
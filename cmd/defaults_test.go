@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadResolvedConfigFileKeepsTheSourceOfTheDefaults(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, repositoryConfigFile, `defaults:
+  builders:
+    go:
+      goversion: 1.20
+  clusters:
+    services:
+      deploymentfile: k8s/deployment.yaml
+`)
+	writeTestFile(t, filepath.Join("api", "ytbdsettings.json"), `{"servicename": "api", "cluster": "services", "builder": {"type": "go"}}`)
+	if err := loadRepositoryConfig(repositoryConfigFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repositoryConfig = nil })
+
+	node, err := readResolvedConfigFile(filepath.Join("api", "ytbdsettings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goVersion := node.Fields["builder"].Fields["goversion"]
+	if goVersion.Kind != stringNode || goVersion.Value != "1.20" {
+		t.Errorf("expected goversion to be the string 1.20, got the %s %v", goVersion.Kind, goVersion.Value)
+	}
+	if goVersion.position() != "docker-builder.yaml:4:18" {
+		t.Errorf("expected goversion from docker-builder.yaml:4:18, got %s", goVersion.position())
+	}
+	if deploymentFile := node.Fields["deploymentfile"]; deploymentFile.position() != "docker-builder.yaml:7:23" {
+		t.Errorf("expected deploymentfile from docker-builder.yaml:7:23, got %s", deploymentFile.position())
+	}
+}
+
+func TestLoadRepositoryConfigReportsSyntaxErrors(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, repositoryConfigFile, "defaults:\n  builders:\n\tgo: {}\n")
+	t.Cleanup(func() { repositoryConfig = nil })
+
+	err := loadRepositoryConfig(repositoryConfigFile)
+	if err == nil || err.Error() != "docker-builder.yaml:3:1: found character that cannot start any token" {
+		t.Errorf("expected the syntax error at docker-builder.yaml:3:1, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+const defaultDeploymentFile = "deployment.yaml"
+const defaultCluster = "default"
+const defaultNamespace = "default"
+
+// tokenPattern matches the #{Name}# tokens used in the deployment files.
+var tokenPattern = regexp.MustCompile(`#\{([^{}#]+)\}#`)
+
+// replaceTokens replaces the tokens found in values, and leaves the rest for a later step.
+func replaceTokens(content string, values map[string]string) string {
+	return tokenPattern.ReplaceAllStringFunc(content, func(token string) string {
+		name := tokenPattern.FindStringSubmatch(token)[1]
+		if value, found := values[name]; found {
+			return value
+		}
+		return token
+	})
+}
+
+// findTokens returns the unique names of the tokens left in the content.
+func findTokens(content string) []string {
+	names := []string{}
+	for _, match := range tokenPattern.FindAllStringSubmatch(content, -1) {
+		names = append(names, match[1])
+	}
+	return unique(names)
+}
+
+func unique(stringSlice []string) []string {
+	keys := make(map[string]bool)
+	list := []string{}
+	for _, entry := range stringSlice {
+		if _, value := keys[entry]; !value {
+			keys[entry] = true
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func getClusterName(configuration structs.ConfigurationWithProjectPath) string {
+	if configuration.Cluster == "" {
+		return defaultCluster
+	}
+	return configuration.Cluster
+}
+
+// getPinnedImageReference returns the image reference pinned by digest when the digest is known.
+func getPinnedImageReference(imageName string, digest string) string {
+	if digest == "" {
+		return imageName
+	}
+	repository := imageName
+	if index := strings.LastIndex(imageName, ":"); index > strings.LastIndex(imageName, "/") {
+		repository = imageName[:index]
+	}
+	return repository + "@" + digest
+}
+
+// renderDeploymentFile returns the deploymentfile of the service with the build-step tokens replaced.
+// The returned path is empty when the service uses the default deploymentfile and it does not exist.
+func renderDeploymentFile(configuration structs.ConfigurationWithProjectPath, namespace string, image string) (string, string, error) {
+	deploymentFile := configuration.DeploymentFile
+	if deploymentFile == "" {
+		deploymentFile = defaultDeploymentFile
+	}
+	deploymentFilePath := filepath.Join(configuration.ProjectPath, deploymentFile)
+
+	content, err := ioutil.ReadFile(deploymentFilePath)
+	if err != nil {
+		if os.IsNotExist(err) && configuration.DeploymentFile == "" {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+
+	rendered := replaceTokens(string(content), map[string]string{
+		"servicename": configuration.ServiceName,
+		"namespace":   namespace,
+		"image":       image,
+	})
+	return rendered, deploymentFilePath, nil
+}
+
+func getDeploymentArtifactPath(artifactsFolder string, configuration structs.ConfigurationWithProjectPath) string {
+	return filepath.Join(artifactsFolder, getClusterName(configuration), configuration.ServiceName+".yaml")
+}
+
+func copyDeloymentArtifactsToOutputFolder(logger *log.Logger, configuration structs.ConfigurationWithProjectPath, artifactsFolder string, namespace string, image string) error {
+	rendered, deploymentFilePath, err := renderDeploymentFile(configuration, namespace, image)
+	if err != nil {
+		return err
+	}
+
+	if deploymentFilePath == "" {
+		logger.Printf("No %s found. Skipping deployment artifact", defaultDeploymentFile)
+		return nil
+	}
+
+	artifactPath := getDeploymentArtifactPath(artifactsFolder, configuration)
+	if err := os.MkdirAll(filepath.Dir(artifactPath), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(artifactPath, []byte(rendered), 0644); err != nil {
+		return err
+	}
+
+	if tokens := findTokens(rendered); len(tokens) > 0 {
+		logger.Printf("Wrote deployment artifact %s from %s. Tokens left for the release step: %s", artifactPath, deploymentFilePath, strings.Join(tokens, ", "))
+	} else {
+		logger.Printf("Wrote deployment artifact %s from %s", artifactPath, deploymentFilePath)
+	}
+	return nil
+}
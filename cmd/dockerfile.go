@@ -0,0 +1,366 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	builder "github.com/groenlid/docker-builder/cmd/builders"
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// dockerfileCmd represents the dockerfile command
+var dockerfileCmd = &cobra.Command{
+	Use:   "dockerfile <servicename>",
+	Short: "Prints the Dockerfile used to build a service",
+	Long: `Prints the Dockerfile and the build context layout the builder of the service would use.
+With --eject the generated Dockerfile is written next to the config file of the service, and the service is switched to the manual builder.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runDockerfile(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dockerfileCmd)
+	dockerfileCmd.Flags().Bool("eject", false, "Write the generated Dockerfile next to the config file and switch the service to the manual builder")
+}
+
+func runDockerfile(cmd *cobra.Command, args []string) {
+	eject, _ := cmd.Flags().GetBool("eject")
+
+	configurations, err := findYT3ConfigurationFiles(".")
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	configuration, err := findConfigurationByServiceName(configurations, args[0])
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	arguments, err := builder.Manager.GetBuildArgumentsForProject(configuration)
+	if err != nil {
+		exitWithConfigError(newServiceError(configuration, phaseBuilder, err))
+	}
+	if arguments == nil {
+		exitWithConfigError(newServiceError(configuration, phaseBuilder, errors.New("the builder does not build an image for the service")))
+	}
+	defer arguments.Cleanup()
+
+	if eject {
+		if err := ejectDockerfile(configuration, arguments); err != nil {
+			arguments.Cleanup()
+			exitWithConfigError(newServiceError(configuration, phaseBuilder, err))
+		}
+		return
+	}
+
+	dockerfile, err := getDockerfileContent(arguments)
+	if err != nil {
+		arguments.Cleanup()
+		exitWithConfigError(newServiceError(configuration, phaseBuilder, err))
+	}
+
+	fmt.Println("# Build context:")
+	for _, line := range getContextLayout(arguments) {
+		fmt.Printf("#   %s\n", line)
+	}
+	if arguments.DockerFilePath != "" {
+		fmt.Printf("# Dockerfile: %s\n", arguments.DockerFilePath)
+	} else {
+		fmt.Println("# Dockerfile: generated")
+	}
+	fmt.Println(dockerfile)
+}
+
+func findConfigurationByServiceName(configurations []structs.ConfigurationWithProjectPath, serviceName string) (structs.ConfigurationWithProjectPath, error) {
+	for _, configuration := range configurations {
+		if configuration.ServiceName == serviceName {
+			return configuration, nil
+		}
+	}
+	return structs.ConfigurationWithProjectPath{}, fmt.Errorf("no service named %s found", serviceName)
+}
+
+// getContextLayout describes where each path of the build context ends up inside the context.
+// Temporary paths created by the builder are left out, as they only hold the generated Dockerfile.
+func getContextLayout(arguments *builder.BuildArguments) []string {
+	lines := []string{}
+	for source, inContext := range getContextPathsWithoutTemporaryPaths(arguments) {
+		lines = append(lines, fmt.Sprintf("%s -> /%s", source, inContext))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func getContextPathsWithoutTemporaryPaths(arguments *builder.BuildArguments) map[string]string {
+	contextPaths := map[string]string{}
+	for source, inContext := range arguments.DockerBuildContextPaths {
+		isTemporary := false
+		for _, temporaryPath := range arguments.TemporaryPaths {
+			if source == temporaryPath {
+				isTemporary = true
+			}
+		}
+		if !isTemporary {
+			contextPaths[source] = inContext
+		}
+	}
+	return contextPaths
+}
+
+// getDockerfileContent returns the generated Dockerfile, or reads the Dockerfile from the build context.
+func getDockerfileContent(arguments *builder.BuildArguments) (string, error) {
+	if arguments.DockerFileContent != "" {
+		return arguments.DockerFileContent, nil
+	}
+
+	for source, inContext := range arguments.DockerBuildContextPaths {
+		if inContext != "" {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(source, arguments.DockerFilePath))
+		if err == nil {
+			return string(content), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("could not find the Dockerfile %s in the build context", arguments.DockerFilePath)
+}
+
+// getEjectedBuildContext returns the manual builder buildcontext matching the context of the generated Dockerfile.
+func getEjectedBuildContext(configuration structs.ConfigurationWithProjectPath, arguments *builder.BuildArguments) (string, error) {
+	contextPaths := getContextPathsWithoutTemporaryPaths(arguments)
+	if len(contextPaths) == 1 {
+		if inContext, found := contextPaths["."]; found && inContext == "" {
+			return "root", nil
+		}
+		if inContext, found := contextPaths[configuration.ProjectPath]; found && inContext == "" {
+			return "projectdir", nil
+		}
+	}
+
+	// Paths added at the same path they have in the working directory are all part of the root context.
+	for source, inContext := range contextPaths {
+		if filepath.Clean(source) == "." && inContext == "" {
+			continue
+		}
+		if filepath.ToSlash(filepath.Clean(source)) != inContext {
+			return "", fmt.Errorf("the build context %v can not be expressed with the manual builder", contextPaths)
+		}
+	}
+	return "root", nil
+}
+
+type ejectedBuilderConfig struct {
+	Type         string `json:"type" yaml:"type"`
+	DockerFile   string `json:"dockerfile" yaml:"dockerfile"`
+	BuildContext string `json:"buildcontext" yaml:"buildcontext"`
+}
+
+// getEjectedConfigFile returns the config file with the builder replaced.
+// Only the builder is changed, so the rest of the file keeps its format and the repository defaults are not written into it.
+func getEjectedConfigFile(file string, builderConfig ejectedBuilderConfig) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		return getEjectedYAMLConfig(content, builderConfig)
+	}
+	return getEjectedJSONConfig(file, content, builderConfig)
+}
+
+func getEjectedJSONConfig(file string, content []byte, builderConfig ejectedBuilderConfig) ([]byte, error) {
+	node, err := parseConfigFile(file, content)
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind != objectNode || len(node.Keys) == 0 {
+		return nil, fmt.Errorf("%s is not an object with a servicename", file)
+	}
+
+	// The builder is replaced where it is, or added in front of the first key with the same indentation.
+	position := node.Keys[0]
+	builder, found := node.Fields["builder"]
+	if found {
+		position = builder
+	}
+	start, end, err := getJSONValueSpan(content, position.Line, position.Column)
+	if err != nil {
+		return nil, err
+	}
+	linePrefix := content[bytes.LastIndexByte(content[:start], '\n')+1 : start]
+	indentation := linePrefix[:len(linePrefix)-len(bytes.TrimLeft(linePrefix, " \t"))]
+
+	// The keys of the root are assumed to be indented by one level, which is used for the builder keys as well.
+	indentationLevel := string(indentation)
+	if indentationLevel == "" {
+		indentationLevel = "    "
+	}
+	builderContent, err := json.MarshalIndent(builderConfig, string(indentation), indentationLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	ejected := append([]byte{}, content[:start]...)
+	if found {
+		ejected = append(ejected, builderContent...)
+		ejected = append(ejected, content[end:]...)
+	} else {
+		ejected = append(ejected, []byte(`"builder": `)...)
+		ejected = append(ejected, builderContent...)
+		ejected = append(ejected, ',', '\n')
+		ejected = append(ejected, indentation...)
+		ejected = append(ejected, content[start:]...)
+	}
+	return ejected, nil
+}
+
+func getEjectedYAMLConfig(content []byte, builderConfig ejectedBuilderConfig) ([]byte, error) {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("the config is not a mapping with a servicename")
+	}
+
+	builderNode := &yaml.Node{}
+	if err := builderNode.Encode(builderConfig); err != nil {
+		return nil, err
+	}
+
+	root := document.Content[0]
+	replaced := false
+	for index := 0; index+1 < len(root.Content); index += 2 {
+		if root.Content[index].Value == "builder" {
+			builderNode.HeadComment = root.Content[index+1].HeadComment
+			builderNode.LineComment = root.Content[index+1].LineComment
+			root.Content[index+1] = builderNode
+			replaced = true
+		}
+	}
+	if !replaced {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "builder"}, builderNode)
+	}
+
+	buffer := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func ejectDockerfile(configuration structs.ConfigurationWithProjectPath, arguments *builder.BuildArguments) error {
+	if arguments.DockerFileContent == "" {
+		return errors.New("the service does not use a generated Dockerfile")
+	}
+
+	buildContext, err := getEjectedBuildContext(configuration, arguments)
+	if err != nil {
+		return err
+	}
+
+	dockerFilePath := filepath.Join(configuration.ProjectPath, "Dockerfile")
+	if _, err := os.Stat(dockerFilePath); err == nil {
+		return fmt.Errorf("%s already exists", dockerFilePath)
+	}
+
+	configContent, err := getEjectedConfigFile(configuration.ConfigFilePath, ejectedBuilderConfig{
+		Type:         "manual",
+		DockerFile:   "Dockerfile",
+		BuildContext: buildContext,
+	})
+	if err != nil {
+		return err
+	}
+
+	generatedFiles, err := getGeneratedContextFiles(arguments)
+	if err != nil {
+		return err
+	}
+	for name := range generatedFiles {
+		if _, err := os.Stat(filepath.Join(configuration.ProjectPath, name)); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(configuration.ProjectPath, name))
+		}
+	}
+
+	dockerfileContent := getEjectedDockerfileContent(arguments.DockerFileContent, generatedFiles, buildContext, configuration.ProjectPath)
+	if err := ioutil.WriteFile(dockerFilePath, []byte(dockerfileContent), 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s", dockerFilePath)
+
+	for name, content := range generatedFiles {
+		generatedFilePath := filepath.Join(configuration.ProjectPath, name)
+		if err := ioutil.WriteFile(generatedFilePath, content, 0644); err != nil {
+			return err
+		}
+		log.Printf("Wrote %s", generatedFilePath)
+	}
+
+	if err := ioutil.WriteFile(configuration.ConfigFilePath, configContent, 0644); err != nil {
+		return err
+	}
+	log.Printf("Switched %s to the manual builder with buildcontext %s", configuration.ConfigFilePath, buildContext)
+	return nil
+}
+
+// getEjectedDockerfileContent returns the Dockerfile with the generated files copied from the folder of the config file,
+// where they are written to. The generated Dockerfile copies them from the root of the build context.
+func getEjectedDockerfileContent(content string, generatedFiles map[string][]byte, buildContext string, projectPath string) string {
+	if buildContext != "root" || filepath.Clean(projectPath) == "." {
+		return content
+	}
+	for name := range generatedFiles {
+		copyCommand := regexp.MustCompile(`(?m)^(\s*COPY\s+(?:--\S+\s+)*)` + regexp.QuoteMeta(name) + `(\s)`)
+		content = copyCommand.ReplaceAllString(content, "${1}"+path.Join(filepath.ToSlash(projectPath), name)+"${2}")
+	}
+	return content
+}
+
+// getGeneratedContextFiles returns the files besides the Dockerfile the builder generated at the root of the build context, like web server configs.
+func getGeneratedContextFiles(arguments *builder.BuildArguments) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, temporaryPath := range arguments.TemporaryPaths {
+		if inContext, found := arguments.DockerBuildContextPaths[temporaryPath]; !found || inContext != "" {
+			continue
+		}
+		direntries, err := os.ReadDir(temporaryPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, direntry := range direntries {
+			if direntry.IsDir() || direntry.Name() == "Dockerfile" {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(temporaryPath, direntry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			files[direntry.Name()] = content
+		}
+	}
+	return files, nil
+}
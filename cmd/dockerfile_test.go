@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testEjectedBuilder = ejectedBuilderConfig{
+	Type:         "manual",
+	DockerFile:   "Dockerfile",
+	BuildContext: "root",
+}
+
+func TestGetEjectedConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{
+			name: "json builder replaced",
+			file: "ytbdsettings.json",
+			content: `// The api
+{
+    "servicename": "api", // the name
+    "builder": {
+        "type": "go",
+        "goversion": "1.17", /* pinned */
+    },
+    "deploymentfile": "deploy.yaml",
+}
+`,
+			expected: `// The api
+{
+    "servicename": "api", // the name
+    "builder": {
+        "type": "manual",
+        "dockerfile": "Dockerfile",
+        "buildcontext": "root"
+    },
+    "deploymentfile": "deploy.yaml",
+}
+`,
+		},
+		{
+			name: "json builder from the defaults",
+			file: "ytbdsettings.json",
+			content: `{
+  "servicename": "api"
+}
+`,
+			expected: `{
+  "builder": {
+    "type": "manual",
+    "dockerfile": "Dockerfile",
+    "buildcontext": "root"
+  },
+  "servicename": "api"
+}
+`,
+		},
+		{
+			name: "yaml builder replaced",
+			file: "ytbdsettings.yaml",
+			content: `# The api
+servicename: api # the name
+builder:
+  type: go
+  goversion: "1.17"
+deploymentfile: deploy.yaml
+`,
+			expected: `# The api
+servicename: api # the name
+builder:
+  type: manual
+  dockerfile: Dockerfile
+  buildcontext: root
+deploymentfile: deploy.yaml
+`,
+		},
+		{
+			name:    "yaml builder from the defaults",
+			file:    "ytbdsettings.yml",
+			content: "servicename: api\n",
+			expected: `servicename: api
+builder:
+  type: manual
+  dockerfile: Dockerfile
+  buildcontext: root
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := chdirToTempDir(t)
+			file := filepath.Join(dir, test.file)
+			writeTestFile(t, file, test.content)
+
+			ejected, err := getEjectedConfigFile(file, testEjectedBuilder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ejected) != test.expected {
+				t.Errorf("expected the config\n%s\ngot\n%s", test.expected, ejected)
+			}
+		})
+	}
+}
+
+func TestGetEjectedDockerfileContentCopiesTheGeneratedFilesFromTheProject(t *testing.T) {
+	content := "FROM nginx\nCOPY docker-builder-static.conf /etc/nginx/conf.d/default.conf\nCOPY --from=build-env /usr/src/app/dist /usr/share/nginx/html\n"
+	generatedFiles := map[string][]byte{"docker-builder-static.conf": []byte("server {}\n")}
+
+	tests := []struct {
+		name         string
+		buildContext string
+		projectPath  string
+		expected     string
+	}{
+		{"root context", "root", filepath.Join("apps", "web"), "COPY apps/web/docker-builder-static.conf /etc/nginx/conf.d/default.conf\n"},
+		{"project at the root", "root", ".", "COPY docker-builder-static.conf /etc/nginx/conf.d/default.conf\n"},
+		{"project context", "projectdir", filepath.Join("apps", "web"), "COPY docker-builder-static.conf /etc/nginx/conf.d/default.conf\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ejected := getEjectedDockerfileContent(content, generatedFiles, test.buildContext, test.projectPath)
+			if !strings.Contains(ejected, test.expected) {
+				t.Errorf("expected %q in the Dockerfile, got %q", test.expected, ejected)
+			}
+			if !strings.Contains(ejected, "COPY --from=build-env /usr/src/app/dist /usr/share/nginx/html\n") {
+				t.Errorf("expected the other copies to be kept, got %q", ejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"gopkg.in/yaml.v3"
+)
+
+// checkForDuplicateServices finds services that would overwrite each other, either because they
+// share a servicename, or because their deploymentfiles render to the same kubernetes object.
+func checkForDuplicateServices(configurations []structs.ConfigurationWithProjectPath, namespace string) []error {
+	errs := []error{}
+
+	byServiceName := map[string][]structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		byServiceName[configuration.ServiceName] = append(byServiceName[configuration.ServiceName], configuration)
+	}
+
+	for _, serviceName := range getSortedKeys(byServiceName) {
+		if duplicates := byServiceName[serviceName]; len(duplicates) > 1 {
+			message := fmt.Sprintf("duplicate servicename %s in %s. The images would be tagged with the same name", serviceName, formatProjectPaths(duplicates))
+			if clusters := getSharedClusters(duplicates); len(clusters) > 0 {
+				message += fmt.Sprintf(", and the deployments to cluster %s would replace each other", strings.Join(clusters, " and "))
+			}
+			errs = append(errs, errors.New(message))
+		}
+	}
+
+	byObject := map[string][]structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		objects, err := getDeploymentObjects(configuration, namespace)
+		if err != nil {
+			errs = append(errs, newServiceError(configuration, phaseConfig, err))
+			continue
+		}
+		for _, object := range objects {
+			byObject[object] = append(byObject[object], configuration)
+		}
+	}
+
+	for _, object := range getSortedKeys(byObject) {
+		if duplicates := byObject[object]; len(duplicates) > 1 {
+			errs = append(errs, fmt.Errorf("the deploymentfiles in %s all create the kubernetes object %s", formatProjectPaths(duplicates), object))
+		}
+	}
+
+	return errs
+}
+
+// getSharedClusters returns the clusters more than one of the services are deployed to.
+func getSharedClusters(configurations []structs.ConfigurationWithProjectPath) []string {
+	byCluster := map[string][]structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		byCluster[getClusterName(configuration)] = append(byCluster[getClusterName(configuration)], configuration)
+	}
+	clusters := []string{}
+	for _, cluster := range getSortedKeys(byCluster) {
+		if len(byCluster[cluster]) > 1 {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+func formatProjectPaths(configurations []structs.ConfigurationWithProjectPath) string {
+	paths := []string{}
+	for _, configuration := range configurations {
+		paths = append(paths, configuration.ProjectPath)
+	}
+	return strings.Join(paths, " and ")
+}
+
+func getSortedKeys(values map[string][]structs.ConfigurationWithProjectPath) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type kubernetesObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// getDeploymentObjects returns the cluster/namespace/kind/name of every kubernetes object in the deploymentfile of the service.
+func getDeploymentObjects(configuration structs.ConfigurationWithProjectPath, namespace string) ([]string, error) {
+	rendered, deploymentFilePath, err := renderDeploymentFile(configuration, namespace, "")
+	if err != nil || deploymentFilePath == "" {
+		return nil, err
+	}
+
+	objects := []string{}
+	decoder := yaml.NewDecoder(strings.NewReader(rendered))
+	for {
+		object := kubernetesObject{}
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %v", deploymentFilePath, err)
+		}
+		if object.Kind == "" || object.Metadata.Name == "" {
+			continue
+		}
+
+		objectNamespace := object.Metadata.Namespace
+		if objectNamespace == "" {
+			objectNamespace = namespace
+		}
+		objects = append(objects, fmt.Sprintf("%s/%s/%s/%s", getClusterName(configuration), objectNamespace, object.Kind, object.Metadata.Name))
+	}
+	return unique(objects), nil
+}
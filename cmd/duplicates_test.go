@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+func TestCheckForDuplicateServicesReportsEachServicenameOnce(t *testing.T) {
+	chdirToTempDir(t)
+
+	tests := []struct {
+		name     string
+		clusters []string
+		message  string
+	}{
+		{"same cluster", []string{"services", "services"}, "duplicate servicename api in a and b. The images would be tagged with the same name, and the deployments to cluster services would replace each other"},
+		{"other clusters", []string{"services", "controller"}, "duplicate servicename api in a and b. The images would be tagged with the same name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configurations := []structs.ConfigurationWithProjectPath{
+				{Configuration: structs.Configuration{ServiceName: "api", Cluster: test.clusters[0]}, ProjectPath: "a"},
+				{Configuration: structs.Configuration{ServiceName: "api", Cluster: test.clusters[1]}, ProjectPath: "b"},
+			}
+
+			errs := checkForDuplicateServices(configurations, defaultNamespace)
+			if len(errs) != 1 || errs[0].Error() != test.message {
+				t.Errorf("expected the single error %q, got %v", test.message, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	builder "github.com/groenlid/docker-builder/cmd/builders"
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the services and how they will be built",
+	Long:  `Lists the services under the current working directory together with the build plan resolved by their builder`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runList(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringP("output", "o", "table", "The output format. Either table or json")
+	listCmd.Flags().Bool("resolved", false, "Show the effective config of every service and where each value came from")
+	addServiceSelectionFlags(listCmd.Flags())
+}
+
+type serviceListItem struct {
+	ServiceName  string            `json:"servicename"`
+	Cluster      string            `json:"cluster"`
+	ProjectPath  string            `json:"projectpath"`
+	BuilderType  string            `json:"builder"`
+	ContextPaths map[string]string `json:"contextpaths"`
+	// DockerFile is the path of the Dockerfile inside the build context.
+	DockerFile          string          `json:"dockerfile"`
+	DockerFileGenerated bool            `json:"dockerfilegenerated"`
+	ContextHash         string          `json:"contexthash"`
+	ServiceHash         string          `json:"servicehash"`
+	Resolved            []resolvedValue `json:"resolved,omitempty"`
+	Error               string          `json:"error,omitempty"`
+	err                 *serviceError
+}
+
+func (item *serviceListItem) setError(err *serviceError) {
+	item.err = err
+	item.Error = err.Error()
+}
+
+func runList(cmd *cobra.Command, args []string) {
+	output, _ := cmd.Flags().GetString("output")
+	resolved, _ := cmd.Flags().GetBool("resolved")
+	if output != "table" && output != "json" {
+		exitWithConfigError(fmt.Errorf("invalid output format %s. Use table or json", output))
+	}
+
+	configurations := discoverConfigurations(cmd.Flags())
+
+	items := []serviceListItem{}
+	failed := []*serviceError{}
+	for _, configuration := range configurations {
+		item := getServiceListItem(configuration)
+		if resolved {
+			node, err := readResolvedConfigFile(configuration.ConfigFilePath)
+			if err != nil {
+				exitWithConfigError(err)
+			}
+			item.Resolved = getResolvedValues(node, "")
+		}
+		if item.err != nil {
+			failed = append(failed, item.err)
+		}
+		items = append(items, item)
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(items); err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		printServiceListTable(items)
+		if resolved {
+			printResolvedValues(items)
+		}
+	}
+
+	if exitCode := getExitCode(failed); exitCode != exitCodeSuccess {
+		os.Exit(exitCode)
+	}
+}
+
+func getServiceListItem(configuration structs.ConfigurationWithProjectPath) serviceListItem {
+	item := serviceListItem{
+		ServiceName: configuration.ServiceName,
+		Cluster:     getClusterName(configuration),
+		ProjectPath: configuration.ProjectPath,
+	}
+
+	builderType, err := builder.GetBuilderType(configuration)
+	if err != nil {
+		item.setError(newServiceError(configuration, phaseConfig, err))
+		return item
+	}
+	item.BuilderType = builderType
+	if item.BuilderType == "" {
+		item.BuilderType = "manual"
+	}
+
+	arguments, err := builder.Manager.GetBuildArgumentsForProject(configuration)
+	if err != nil {
+		item.setError(newServiceError(configuration, phaseBuilder, err))
+		return item
+	}
+	if arguments == nil {
+		return item
+	}
+	defer arguments.Cleanup()
+
+	// The temporary paths are removed once the list is printed, so they are left out.
+	item.ContextPaths = getContextPathsWithoutTemporaryPaths(arguments)
+	item.DockerFile = arguments.DockerFilePath
+	if arguments.DockerFileContent != "" {
+		// The generated Dockerfile is added to the root of the build context. The dockerfile command prints it.
+		item.DockerFile = "Dockerfile"
+		item.DockerFileGenerated = true
+	}
+
+	contextHash, err := getContextHash(context.Background(), log.New(ioutil.Discard, "", 0), arguments)
+	if err != nil {
+		item.setError(newServiceError(configuration, phaseContext, err))
+		return item
+	}
+	item.ContextHash = contextHash
+	item.ServiceHash = getServiceHash(configuration, arguments, contextHash)
+	return item
+}
+
+func formatContextPaths(contextPaths map[string]string) string {
+	formatted := []string{}
+	for source, inContext := range contextPaths {
+		if inContext == "" {
+			formatted = append(formatted, source)
+		} else {
+			formatted = append(formatted, source+":"+inContext)
+		}
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ",")
+}
+
+func printServiceListTable(items []serviceListItem) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SERVICE\tCLUSTER\tPATH\tBUILDER\tCONTEXT PATHS\tDOCKERFILE\tCONTEXT HASH")
+	for _, item := range items {
+		if item.Error != "" {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\tERROR: %s\t\t\n", item.ServiceName, item.Cluster, item.ProjectPath, item.BuilderType, item.Error)
+			continue
+		}
+		dockerFile := item.DockerFile
+		if item.DockerFileGenerated {
+			dockerFile += " (generated)"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.ServiceName, item.Cluster, item.ProjectPath, item.BuilderType, formatContextPaths(item.ContextPaths), dockerFile, item.ContextHash)
+	}
+	writer.Flush()
+}
+
+func printResolvedValues(items []serviceListItem) {
+	for _, item := range items {
+		fmt.Printf("\n%s:\n", item.ServiceName)
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, value := range item.Resolved {
+			fmt.Fprintf(writer, "  %s\t%v\t%s\n", value.Key, value.Value, value.Source)
+		}
+		writer.Flush()
+	}
+}
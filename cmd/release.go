@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// releaseCmd represents the release command
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Replaces the variables in the deployment artifacts",
+	Long: `Replaces the #{Name}# tokens left in the deployment artifacts created by the build command.
+Values are taken from the environment variables, the variables file of the environment and the --var flags, in that order of precedence.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runRelease(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+	releaseCmd.Flags().String("artifacts", "artifacts", "The folder containing the deployment artifacts created by the build command")
+	releaseCmd.Flags().StringP("environment", "e", "", "The environment to release to. Variables are read from <variables>/<environment>.yaml")
+	releaseCmd.Flags().String("variables", "variables", "The folder containing a variables file per environment")
+	releaseCmd.Flags().StringArray("var", []string{}, "A variable given as Name=Value. Can be given multiple times")
+	releaseCmd.Flags().String("output", "release", "The folder the released deployment files are written to")
+	releaseCmd.Flags().Bool("dry-run", false, "Print the released deployment files instead of writing them")
+	releaseCmd.Flags().StringSlice("cluster", []string{}, "Only release the services deployed to the given clusters")
+}
+
+type releaseManifest struct {
+	ArtifactPath string
+	Cluster      string
+	Content      string
+}
+
+func runRelease(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	artifactsFolder, _ := flags.GetString("artifacts")
+	environment, _ := flags.GetString("environment")
+	variablesFolder, _ := flags.GetString("variables")
+	variableFlags, _ := flags.GetStringArray("var")
+	outputFolder, _ := flags.GetString("output")
+	dryRun, _ := flags.GetBool("dry-run")
+	clusters, _ := flags.GetStringSlice("cluster")
+	if err := validateClusterNames(clusters); err != nil {
+		exitWithConfigError(err)
+	}
+
+	variables, err := getReleaseVariables(environment, variablesFolder, variableFlags)
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	manifests, err := readDeploymentArtifacts(artifactsFolder, clusters)
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	if err := replaceManifestTokens(manifests, variables); err != nil {
+		exitWithConfigError(err)
+	}
+
+	for _, manifest := range manifests {
+		relativePath, err := filepath.Rel(artifactsFolder, manifest.ArtifactPath)
+		if err != nil {
+			exitWithConfigError(err)
+		}
+
+		if dryRun {
+			fmt.Printf("---\n# %s\n%s\n", relativePath, strings.TrimSpace(manifest.Content))
+			continue
+		}
+
+		outputPath := filepath.Join(outputFolder, relativePath)
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			exitWithConfigError(err)
+		}
+		if err := ioutil.WriteFile(outputPath, []byte(manifest.Content), 0644); err != nil {
+			exitWithConfigError(err)
+		}
+		log.Printf("Wrote %s", outputPath)
+	}
+
+	printReleaseSummary(manifests)
+}
+
+// replaceManifestTokens replaces the tokens in the manifests, and fails when any token is left unresolved.
+func replaceManifestTokens(manifests []releaseManifest, variables map[string]string) error {
+	unresolved := false
+	for index, manifest := range manifests {
+		content := replaceTokens(manifest.Content, variables)
+		if tokens := findTokens(content); len(tokens) > 0 {
+			unresolved = true
+			log.Printf("Unresolved variables in %s: %s", manifest.ArtifactPath, strings.Join(tokens, ", "))
+		}
+		manifests[index].Content = content
+	}
+
+	if unresolved {
+		return fmt.Errorf("unable to release. Give the missing variables as environment variables, in the variables file or with --var")
+	}
+	return nil
+}
+
+func printReleaseSummary(manifests []releaseManifest) {
+	manifestsInCluster := map[string]int{}
+	for _, manifest := range manifests {
+		manifestsInCluster[manifest.Cluster]++
+	}
+
+	log.Println("Release summary:")
+	for _, cluster := range getSortedClusters(manifestsInCluster) {
+		log.Printf("Cluster %s: %d services", cluster, manifestsInCluster[cluster])
+	}
+}
+
+// readDeploymentArtifacts reads the artifacts written to <artifacts>/<cluster>/<servicename>.yaml by the build command.
+func readDeploymentArtifacts(artifactsFolder string, clusters []string) ([]releaseManifest, error) {
+	manifests := []releaseManifest{}
+	err := filepath.Walk(artifactsFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || filepath.Ext(path) != ".yaml" {
+			return nil
+		}
+
+		cluster := filepath.Base(filepath.Dir(path))
+		if !isClusterSelected(cluster, clusters) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		manifests = append(manifests, releaseManifest{
+			ArtifactPath: path,
+			Cluster:      cluster,
+			Content:      string(content),
+		})
+		return nil
+	})
+	return manifests, err
+}
+
+// getReleaseVariables merges the environment variables, the variables file and the --var flags.
+// Later sources override the earlier ones.
+func getReleaseVariables(environment string, variablesFolder string, variableFlags []string) (map[string]string, error) {
+	variables := map[string]string{}
+
+	for _, environmentVariable := range os.Environ() {
+		parts := strings.SplitN(environmentVariable, "=", 2)
+		variables[parts[0]] = parts[1]
+	}
+
+	if environment != "" {
+		fileVariables, err := readVariablesFile(environment, variablesFolder)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileVariables {
+			variables[name] = value
+		}
+	}
+
+	for _, variableFlag := range variableFlags {
+		parts := strings.SplitN(variableFlag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid variable %s. Variables must be given as Name=Value", variableFlag)
+		}
+		variables[parts[0]] = parts[1]
+	}
+
+	return variables, nil
+}
+
+func readVariablesFile(environment string, variablesFolder string) (map[string]string, error) {
+	candidates := []string{}
+	for _, extension := range []string{".yaml", ".yml", ".json"} {
+		candidates = append(candidates, filepath.Join(variablesFolder, environment+extension))
+	}
+
+	for _, candidate := range candidates {
+		content, err := ioutil.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fileVariables := map[string]interface{}{}
+		if err := yaml.Unmarshal(content, &fileVariables); err != nil {
+			return nil, fmt.Errorf("unable to read variables file %s: %v", candidate, err)
+		}
+
+		variables := map[string]string{}
+		for name, value := range fileVariables {
+			if value == nil {
+				variables[name] = ""
+				continue
+			}
+			variables[name] = fmt.Sprint(value)
+		}
+		log.Printf("Using variables file %s", candidate)
+		return variables, nil
+	}
+
+	return nil, fmt.Errorf("no variables file found for environment %s. Looked for %s", environment, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setTestEnv(t *testing.T, name string, value string) {
+	previous, found := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if found {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestGetReleaseVariablesPrecedence(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("variables", "prod.yaml"), "FROM_FILE: file\nFILE_AND_VAR: file\nENV_AND_FILE: file\nREPLICAS: 3\nEMPTY:\n")
+	setTestEnv(t, "DOCKER_BUILDER_TEST_ENV_ONLY", "env")
+	setTestEnv(t, "ENV_AND_FILE", "env")
+	setTestEnv(t, "ENV_AND_VAR", "env")
+
+	variables, err := getReleaseVariables("prod", "variables", []string{"FILE_AND_VAR=var", "ENV_AND_VAR=var", "WITH_EQUALS=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"DOCKER_BUILDER_TEST_ENV_ONLY": "env",
+		"FROM_FILE":                    "file",
+		"ENV_AND_FILE":                 "file",
+		"FILE_AND_VAR":                 "var",
+		"ENV_AND_VAR":                  "var",
+		"WITH_EQUALS":                  "a=b",
+		"REPLICAS":                     "3",
+		"EMPTY":                        "",
+	}
+	for name, value := range expected {
+		if variables[name] != value {
+			t.Errorf("expected %s to be %q, got %q", name, value, variables[name])
+		}
+	}
+}
+
+func TestGetReleaseVariablesErrors(t *testing.T) {
+	chdirToTempDir(t)
+	writeTestFile(t, filepath.Join("variables", "broken.yaml"), "- not\n- a map\n")
+
+	tests := []struct {
+		name          string
+		environment   string
+		variableFlags []string
+	}{
+		{"missing variables file", "test", nil},
+		{"invalid variables file", "broken", nil},
+		{"variable without value", "", []string{"NAME"}},
+		{"variable without name", "", []string{"=value"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := getReleaseVariables(test.environment, "variables", test.variableFlags); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReplaceManifestTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		expected   string
+		unresolved bool
+	}{
+		{"every token resolved", "image: #{Image}#\nhost: #{Host}#.example.com\n", "image: api:1\nhost: api.example.com\n", false},
+		{"token left", "image: #{Image}#\nsecret: #{Secret}#\n", "image: api:1\nsecret: #{Secret}#\n", true},
+		{"no tokens", "kind: Service\n", "kind: Service\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifests := []releaseManifest{{ArtifactPath: filepath.Join("artifacts", "services", "api.yaml"), Cluster: "services", Content: test.content}}
+
+			err := replaceManifestTokens(manifests, map[string]string{"Image": "api:1", "Host": "api"})
+
+			if (err != nil) != test.unresolved {
+				t.Errorf("expected unresolved to be %v, got the error %v", test.unresolved, err)
+			}
+			if manifests[0].Content != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, manifests[0].Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+const (
+	exitCodeSuccess      = 0
+	exitCodeBuildFailure = 1
+	exitCodeConfigError  = 2
+)
+
+type buildPhase string
+
+const (
+	phaseConfig  buildPhase = "config"
+	phaseBuilder buildPhase = "builder"
+	phaseContext buildPhase = "context"
+	phaseBuild   buildPhase = "build"
+	phasePush    buildPhase = "push"
+	phaseDeploy  buildPhase = "deploy"
+)
+
+// serviceError is returned by the build steps and tells which service failed, and in which phase.
+type serviceError struct {
+	ServiceName string
+	ProjectPath string
+	Phase       buildPhase
+	Err         error
+}
+
+func newServiceError(configuration structs.ConfigurationWithProjectPath, phase buildPhase, err error) *serviceError {
+	if serviceErr, ok := err.(*serviceError); ok {
+		return serviceErr
+	}
+	return &serviceError{
+		ServiceName: configuration.ServiceName,
+		ProjectPath: configuration.ProjectPath,
+		Phase:       phase,
+		Err:         err,
+	}
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("%s failed for service %s at path %s: %v", e.Phase, e.ServiceName, e.ProjectPath, e.Err)
+}
+
+func (e *serviceError) Unwrap() error {
+	return e.Err
+}
+
+type buildResult struct {
+	ServiceName string
+	Cluster     string
+	Image       string
+	Digest      string
+	Skipped     bool
+	Err         *serviceError
+}
+
+type buildReport struct {
+	Results []buildResult
+}
+
+func newBuildReport(results []buildResult) *buildReport {
+	return &buildReport{
+		Results: results,
+	}
+}
+
+func (r *buildReport) failed() []*serviceError {
+	failed := []*serviceError{}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result.Err)
+		}
+	}
+	return failed
+}
+
+// isConfigError returns true when the service failed because of its configuration. The builder fails when the
+// config of the service or the project it points to is invalid, like a missing runcommand or lockfile.
+func (e *serviceError) isConfigError() bool {
+	return e.Phase == phaseConfig || e.Phase == phaseBuilder
+}
+
+// getExitCode returns exitCodeConfigError if any of the errors is a config error, and exitCodeBuildFailure otherwise.
+func getExitCode(errs []*serviceError) int {
+	exitCode := exitCodeSuccess
+	for _, err := range errs {
+		if err.isConfigError() {
+			return exitCodeConfigError
+		}
+		exitCode = exitCodeBuildFailure
+	}
+	return exitCode
+}
+
+// exitCode returns exitCodeConfigError if any service failed because of its configuration,
+// and exitCodeBuildFailure if any service failed in a later phase.
+func (r *buildReport) exitCode() int {
+	return getExitCode(r.failed())
+}
+
+// print logs the result of every service grouped by the cluster it is deployed to.
+func (r *buildReport) print() {
+	servicesInCluster := map[string]int{}
+	failedInCluster := map[string]int{}
+	for _, result := range r.Results {
+		servicesInCluster[result.Cluster]++
+		if result.Err != nil {
+			failedInCluster[result.Cluster]++
+		}
+	}
+
+	log.Println("Build summary:")
+	for _, cluster := range getSortedClusters(servicesInCluster) {
+		log.Printf("Cluster %s: %d services, %d failed", cluster, servicesInCluster[cluster], failedInCluster[cluster])
+		for _, result := range r.Results {
+			if result.Cluster != cluster {
+				continue
+			}
+			switch {
+			case result.Err != nil:
+				log.Printf("  FAILED   %s [%s] %s: %v", result.ServiceName, result.Err.Phase, result.Err.ProjectPath, result.Err.Err)
+			case result.Skipped:
+				log.Printf("  SKIPPED  %s", result.ServiceName)
+			default:
+				log.Printf("  PUSHED   %s %s@%s", result.ServiceName, result.Image, result.Digest)
+			}
+		}
+	}
+	log.Printf("%d services, %d failed", len(r.Results), len(r.failed()))
+}
+
+// exitWithConfigError is used for configuration errors that stop the whole run.
+func exitWithConfigError(err error) {
+	if errs, ok := err.(configErrors); ok {
+		exitWithConfigErrors(errs)
+	}
+	exitWithConfigErrors([]error{err})
+}
+
+func exitWithConfigErrors(errs []error) {
+	for _, err := range errs {
+		log.Printf("%s error: %v", phaseConfig, err)
+	}
+	os.Exit(exitCodeConfigError)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildReportExitCode(t *testing.T) {
+	failure := func(phase buildPhase) buildResult {
+		return buildResult{ServiceName: string(phase), Err: &serviceError{ServiceName: string(phase), Phase: phase, Err: errors.New("failed")}}
+	}
+	pushed := buildResult{ServiceName: "pushed", Digest: "sha256:d1"}
+
+	tests := []struct {
+		name     string
+		results  []buildResult
+		expected int
+	}{
+		{"no failures", []buildResult{pushed}, exitCodeSuccess},
+		{"build failure", []buildResult{pushed, failure(phaseBuild)}, exitCodeBuildFailure},
+		{"push failure", []buildResult{failure(phasePush)}, exitCodeBuildFailure},
+		{"config error", []buildResult{failure(phaseConfig)}, exitCodeConfigError},
+		{"builder error", []buildResult{failure(phaseBuilder)}, exitCodeConfigError},
+		{"builder error after a build failure", []buildResult{failure(phaseBuild), failure(phaseBuilder)}, exitCodeConfigError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if exitCode := newBuildReport(test.results).exitCode(); exitCode != test.expected {
+				t.Errorf("expected the exit code %d, got %d", test.expected, exitCode)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	builder "github.com/groenlid/docker-builder/cmd/builders"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -12,6 +13,9 @@ import (
 
 var cfgFile string
 
+// repositoryConfigFile holds the settings shared by the services in the repository, like the builder defaults.
+const repositoryConfigFile = "docker-builder.yaml"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "docker-builder",
@@ -31,7 +35,7 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initConfig, registerExternalBuilders)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -66,6 +70,27 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+
+	// The repository config file in the working directory is merged on top of the global config.
+	if _, err := os.Stat(repositoryConfigFile); err == nil {
+		if err := loadRepositoryConfig(repositoryConfigFile); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		viper.SetConfigFile(repositoryConfigFile)
+		if err := viper.MergeInConfig(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "Using repository config file:", repositoryConfigFile)
+	}
+}
+
+// registerExternalBuilders registers the docker-builder-builder-<type> executables found in PATH.
+func registerExternalBuilders() {
+	for _, err := range builder.Manager.RegisterExternalBuilders() {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+
+	builder "github.com/groenlid/docker-builder/cmd/builders"
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Prints the JSON Schema of the service config file",
+	Long: `Prints the JSON Schema of the service config file, generated from the registered builders.
+Reference it with "$schema" in the config files to get autocompletion in the editor.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSchema(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().StringP("output", "o", "", "Write the schema to the given file instead of printing it")
+}
+
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+func runSchema(cmd *cobra.Command, args []string) {
+	output, _ := cmd.Flags().GetString("output")
+
+	content, err := json.MarshalIndent(getConfigurationSchema(), "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	content = append(content, '\n')
+
+	if output == "" {
+		os.Stdout.Write(content)
+		return
+	}
+
+	if err := ioutil.WriteFile(output, content, 0644); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Wrote %s", output)
+}
+
+// getConfigurationSchema returns the schema of structs.Configuration where the builder section
+// is a union of the configs of the builders registered in the BuilderManager, discriminated on type.
+func getConfigurationSchema() *jsonSchema {
+	schema := getObjectSchema(reflect.TypeOf(structs.Configuration{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "docker-builder service config"
+	schema.Properties["cluster"].Enum = getAllowedClusters()
+
+	builderSchema := schema.Properties["builder"]
+	builderSchema.Type = ""
+	for _, registeredBuilder := range builder.Manager.Builders {
+		builderSchema.OneOf = append(builderSchema.OneOf, getBuilderSchema(registeredBuilder))
+	}
+	return schema
+}
+
+func getBuilderSchema(registeredBuilder *builder.Builder) *jsonSchema {
+	schema := &jsonSchema{
+		Type:       "object",
+		Properties: map[string]*jsonSchema{},
+	}
+	if registeredBuilder.Config != nil {
+		schema = getObjectSchema(reflect.TypeOf(registeredBuilder.Config))
+	}
+
+	typeSchema := &jsonSchema{
+		Type:        "string",
+		Description: "The builder used to build the service.",
+	}
+	typeIsRequired := true
+	for _, builderName := range registeredBuilder.BuilderNames {
+		if builderName == "" {
+			typeIsRequired = false
+			continue
+		}
+		typeSchema.Enum = append(typeSchema.Enum, builderName)
+	}
+	schema.Properties["type"] = typeSchema
+
+	if typeIsRequired {
+		schema.Required = append([]string{"type"}, schema.Required...)
+	}
+	return schema
+}
+
+func getObjectSchema(configType reflect.Type) *jsonSchema {
+	additionalProperties := false
+	schema := &jsonSchema{
+		Type:                 "object",
+		Properties:           map[string]*jsonSchema{},
+		AdditionalProperties: &additionalProperties,
+	}
+
+	for _, field := range getConfigFields(configType) {
+		fieldSchema := &jsonSchema{
+			Description: field.Description,
+			Enum:        field.Enum,
+		}
+		if kind, ok := getExpectedNodeKind(field.Type); ok {
+			fieldSchema.Type = string(kind)
+		}
+		schema.Properties[field.Name] = fieldSchema
+
+		if field.Required {
+			schema.Required = append(schema.Required, field.Name)
+		}
+	}
+	return schema
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/pflag"
+)
+
+// addServiceSelectionFlags adds the flags used to select which of the discovered services to handle.
+func addServiceSelectionFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("cluster", []string{}, "Only handle the services deployed to the given clusters")
+	flags.StringSlice("only", []string{}, "Only handle the services with the given servicenames. Supports globs like api-*")
+	flags.StringSlice("exclude", []string{}, "Skip the services with the given servicenames. Supports globs like legacy-*")
+	flags.StringSlice("path", []string{}, "Only handle the services with a project path matching the given globs, like services/payments/**")
+}
+
+type selectionPattern struct {
+	Flag    string
+	Pattern string
+	matched bool
+}
+
+func newSelectionPatterns(flag string, patterns []string) []*selectionPattern {
+	selectionPatterns := []*selectionPattern{}
+	for _, pattern := range patterns {
+		selectionPatterns = append(selectionPatterns, &selectionPattern{
+			Flag:    flag,
+			Pattern: pattern,
+		})
+	}
+	return selectionPatterns
+}
+
+// matchAny returns true if any of the patterns match the value, and marks the patterns that matched.
+func matchAny(patterns []*selectionPattern, value string) (bool, error) {
+	matched := false
+	for _, pattern := range patterns {
+		isMatch, err := matchGlob(pattern.Pattern, value)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern %s given to --%s: %v", pattern.Pattern, pattern.Flag, err)
+		}
+		if isMatch {
+			pattern.matched = true
+			matched = true
+		}
+	}
+	return matched, nil
+}
+
+// discoverConfigurations finds the services under the current working directory and selects
+// the ones given by the selection flags. Configuration errors stop the run.
+func discoverConfigurations(flags *pflag.FlagSet) []structs.ConfigurationWithProjectPath {
+	clusters, _ := flags.GetStringSlice("cluster")
+	if err := validateClusterNames(clusters); err != nil {
+		exitWithConfigError(err)
+	}
+
+	configurations, err := findYT3ConfigurationFiles(".")
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	if errs := validateConfigurations(configurations); len(errs) > 0 {
+		exitWithConfigErrors(errs)
+	}
+
+	namespace, err := flags.GetString("namespace")
+	if err != nil {
+		namespace = defaultNamespace
+	}
+	if errs := checkForDuplicateServices(configurations, namespace); len(errs) > 0 {
+		exitWithConfigErrors(errs)
+	}
+	configurations = filterConfigurationsByCluster(configurations, clusters)
+
+	configurations, err = selectConfigurations(flags, configurations)
+	if err != nil {
+		exitWithConfigError(err)
+	}
+	return configurations
+}
+
+// selectConfigurations filters the configurations on the --only, --exclude and --path flags.
+// A pattern that matches none of the services is an error, as it is most likely a typo.
+func selectConfigurations(flags *pflag.FlagSet, configurations []structs.ConfigurationWithProjectPath) ([]structs.ConfigurationWithProjectPath, error) {
+	only, _ := flags.GetStringSlice("only")
+	exclude, _ := flags.GetStringSlice("exclude")
+	paths, _ := flags.GetStringSlice("path")
+
+	onlyPatterns := newSelectionPatterns("only", only)
+	excludePatterns := newSelectionPatterns("exclude", exclude)
+	pathPatterns := newSelectionPatterns("path", paths)
+
+	selected := []structs.ConfigurationWithProjectPath{}
+	for _, configuration := range configurations {
+		projectPath := filepath.ToSlash(filepath.Clean(configuration.ProjectPath))
+
+		isOnly, err := matchAny(onlyPatterns, configuration.ServiceName)
+		if err != nil {
+			return nil, err
+		}
+		isExcluded, err := matchAny(excludePatterns, configuration.ServiceName)
+		if err != nil {
+			return nil, err
+		}
+		isInPath, err := matchAny(pathPatterns, projectPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if (len(onlyPatterns) == 0 || isOnly) && (len(pathPatterns) == 0 || isInPath) && !isExcluded {
+			selected = append(selected, configuration)
+		}
+	}
+
+	unmatched := []string{}
+	for _, patterns := range [][]*selectionPattern{onlyPatterns, excludePatterns, pathPatterns} {
+		for _, pattern := range patterns {
+			if !pattern.matched {
+				unmatched = append(unmatched, fmt.Sprintf("--%s %s", pattern.Flag, pattern.Pattern))
+			}
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no services matched %s", strings.Join(unmatched, ", "))
+	}
+
+	return selected, nil
+}
+
+// matchGlob matches a slash separated value against a pattern, where ** matches any number of path segments.
+func matchGlob(pattern string, value string) (bool, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false, err
+	}
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(value, "/")), nil
+}
+
+func matchGlobSegments(patternSegments []string, valueSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(valueSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for index := 0; index <= len(valueSegments); index++ {
+			if matchGlobSegments(patternSegments[1:], valueSegments[index:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(valueSegments) == 0 {
+		return false
+	}
+
+	isMatch, _ := path.Match(patternSegments[0], valueSegments[0])
+	return isMatch && matchGlobSegments(patternSegments[1:], valueSegments[1:])
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/groenlid/docker-builder/cmd/structs"
+	"github.com/spf13/pflag"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"api", "api", true},
+		{"api-*", "api-users", true},
+		{"api-*", "web", false},
+		{"services/*", "services/payments", true},
+		{"services/*", "services/payments/api", false},
+		{"services/**", "services/payments/api", true},
+		{"services/**", "services", true},
+		{"**/api", "services/payments/api", true},
+		{"**/api", "api", true},
+		{"services/**/api", "services/api", true},
+		{"services/**/api", "services/payments/v2/api", true},
+		{"services/**/api", "services/payments/web", false},
+		{"**", "services/payments/api", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.value, func(t *testing.T) {
+			isMatch, err := matchGlob(test.pattern, test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isMatch != test.expected {
+				t.Errorf("expected %s to match %s to be %v", test.pattern, test.value, test.expected)
+			}
+		})
+	}
+}
+
+func TestMatchGlobRejectsInvalidPatterns(t *testing.T) {
+	if _, err := matchGlob("api-[", "api-1"); err == nil {
+		t.Error("expected the invalid pattern to be rejected")
+	}
+}
+
+func TestSelectConfigurations(t *testing.T) {
+	configurations := []structs.ConfigurationWithProjectPath{
+		{Configuration: structs.Configuration{ServiceName: "api"}, ProjectPath: "services/payments/api"},
+		{Configuration: structs.Configuration{ServiceName: "api-admin"}, ProjectPath: "services/payments/admin"},
+		{Configuration: structs.Configuration{ServiceName: "web"}, ProjectPath: "web"},
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		message  string
+	}{
+		{"no flags", nil, []string{"api", "api-admin", "web"}, ""},
+		{"only glob", []string{"--only", "api*"}, []string{"api", "api-admin"}, ""},
+		{"exclude", []string{"--only", "api*", "--exclude", "api-admin"}, []string{"api"}, ""},
+		{"path", []string{"--path", "services/**"}, []string{"api", "api-admin"}, ""},
+		{"path and only", []string{"--path", "services/**", "--only", "web,api"}, []string{"api"}, ""},
+		{"unmatched only", []string{"--only", "api,wbe"}, nil, "no services matched --only wbe"},
+		{"unmatched patterns", []string{"--exclude", "legacy-*", "--path", "apps/**"}, nil, "no services matched --exclude legacy-*, --path apps/**"},
+		{"invalid pattern", []string{"--only", "api-["}, nil, "invalid pattern api-[ given to --only: syntax error in pattern"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			addServiceSelectionFlags(flags)
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			selected, err := selectConfigurations(flags, configurations)
+			if test.message != "" {
+				if err == nil || err.Error() != test.message {
+					t.Errorf("expected the error %q, got %v", test.message, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := getServiceNames(selected); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
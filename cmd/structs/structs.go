@@ -18,13 +18,16 @@ type BaseBuilder struct {
 }
 
 type Configuration struct {
-	ServiceName    string          `json:"servicename"`
-	Cluster        string          `json:"cluster"`
-	DeploymentFile string          `json:"deploymentfile"`
-	Builder        json.RawMessage `json:"builder"`
+	Schema         string          `json:"$schema,omitempty" description:"The JSON Schema of the config file, used by editors for autocompletion."`
+	ServiceName    string          `json:"servicename" required:"true" description:"The servicename in kubernetes. Also used as the image name."`
+	Cluster        string          `json:"cluster,omitempty" description:"The cluster the service is deployed to."`
+	DeploymentFile string          `json:"deploymentfile,omitempty" description:"The kubernetes deploymentfile, relative to the config file. Defaults to deployment.yaml."`
+	Builder        json.RawMessage `json:"builder,omitempty" description:"How the service is built. Defaults to the manual builder."`
+	Deploy         json.RawMessage `json:"deploy,omitempty" description:"Not used. Allowed so existing config files stay valid."`
 }
 
 type ConfigurationWithProjectPath struct {
 	Configuration
-	ProjectPath string
+	ProjectPath    string
+	ConfigFilePath string
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the config files of the services",
+	Long:  `Validates the config files of the services under the current working directory, and reports the file, line and column of every error`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runValidate(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(cmd *cobra.Command, args []string) {
+	configurations, err := findYT3ConfigurationFiles(".")
+	if err != nil {
+		exitWithConfigError(err)
+	}
+
+	errs := validateConfigurations(configurations)
+	errs = append(errs, checkForDuplicateServices(configurations, defaultNamespace)...)
+	if len(errs) > 0 {
+		exitWithConfigErrors(errs)
+	}
+
+	log.Printf("%d config files are valid", len(configurations))
+}
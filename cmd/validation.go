@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	builder "github.com/groenlid/docker-builder/cmd/builders"
+	"github.com/groenlid/docker-builder/cmd/structs"
+)
+
+// validationError points at the place in a config file that is invalid.
+type validationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *validationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// newValidationError points at the node, or at the config file when the node was not given in a file.
+func newValidationError(file string, node *configNode, format string, args ...interface{}) *validationError {
+	if node.File != "" {
+		file = node.File
+	}
+	return &validationError{
+		File:    file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// configErrors holds every error found in the config files, so they can be reported together.
+type configErrors []error
+
+func (e configErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// validateConfigurations validates the config file of every service.
+func validateConfigurations(configurations []structs.ConfigurationWithProjectPath) []error {
+	errs := []error{}
+	for _, configuration := range configurations {
+		root, err := readResolvedConfigFile(configuration.ConfigFilePath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, validateConfigurationNode(configuration.ConfigFilePath, root)...)
+	}
+	return errs
+}
+
+// validateConfigurationNode checks the config file against structs.Configuration and the config of its builder.
+func validateConfigurationNode(file string, root *configNode) []error {
+	if root.Kind != objectNode {
+		return []error{newValidationError(file, root, "expected the config to be an object, but found %s", root.Kind)}
+	}
+
+	errs := validateObject(file, root, reflect.TypeOf(structs.Configuration{}))
+
+	if cluster, found := root.field("cluster"); found && cluster.Kind == stringNode && cluster.Value != "" {
+		if !isAllowedCluster(cluster.Value.(string)) {
+			errs = append(errs, newValidationError(file, cluster, "invalid cluster %q. Allowed clusters are %s", cluster.Value, strings.Join(getAllowedClusters(), ", ")))
+		}
+	}
+
+	builderNode, found := root.field("builder")
+	if !found || builderNode.Kind != objectNode {
+		return errs
+	}
+
+	builderType := ""
+	typeNode, found := builderNode.field("type")
+	if found && typeNode.Kind == stringNode {
+		builderType = typeNode.Value.(string)
+	}
+
+	registeredBuilder, found := builder.Manager.GetBuilder(builderType)
+	if !found {
+		position := builderNode
+		if typeNode != nil {
+			position = typeNode
+		}
+		return append(errs, newValidationError(file, position, "unknown builder type %q. Known types are %s", builderType, strings.Join(builder.Manager.GetBuilderTypes(), ", ")))
+	}
+
+	if registeredBuilder.Config != nil {
+		errs = append(errs, validateObject(file, builderNode, reflect.TypeOf(registeredBuilder.Config))...)
+	}
+	return errs
+}
+
+// convertScalarsToStrings converts the numbers and booleans given for string fields of the config and its builder
+// to their source text, as yaml reads unquoted versions like nodeversion: 14 as numbers.
+func convertScalarsToStrings(root *configNode) {
+	convertObjectScalarsToStrings(root, reflect.TypeOf(structs.Configuration{}))
+
+	builderNode, found := root.field("builder")
+	if !found {
+		return
+	}
+	if registeredBuilder, found := builder.Manager.GetBuilder(getBuilderTypeOfNode(root)); found && registeredBuilder.Config != nil {
+		convertObjectScalarsToStrings(builderNode, reflect.TypeOf(registeredBuilder.Config))
+	}
+}
+
+func convertObjectScalarsToStrings(node *configNode, configType reflect.Type) {
+	for _, field := range getConfigFields(configType) {
+		value, found := node.field(field.Name)
+		if !found || field.Type.Kind() != reflect.String || value.Text == "" {
+			continue
+		}
+		if value.Kind == numberNode || value.Kind == boolNode {
+			value.Kind = stringNode
+			value.Value = value.Text
+		}
+	}
+}
+
+type configField struct {
+	Name        string
+	Type        reflect.Type
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+// getConfigFields returns the keys of a config struct from its json tags.
+func getConfigFields(configType reflect.Type) []configField {
+	for configType.Kind() == reflect.Ptr {
+		configType = configType.Elem()
+	}
+
+	fields := []configField{}
+	for index := 0; index < configType.NumField(); index++ {
+		field := configType.Field(index)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		configField := configField{
+			Name:        name,
+			Type:        field.Type,
+			Required:    field.Tag.Get("required") == "true",
+			Description: field.Tag.Get("description"),
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			configField.Enum = strings.Split(enum, ",")
+		}
+		fields = append(fields, configField)
+	}
+	return fields
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+func getExpectedNodeKind(fieldType reflect.Type) (configNodeKind, bool) {
+	if fieldType == rawMessageType {
+		return objectNode, true
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		return stringNode, true
+	case reflect.Bool:
+		return boolNode, true
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Float32, reflect.Float64:
+		return numberNode, true
+	case reflect.Slice, reflect.Array:
+		return arrayNode, true
+	case reflect.Map, reflect.Struct:
+		return objectNode, true
+	}
+	return "", false
+}
+
+func validateObject(file string, node *configNode, configType reflect.Type) []error {
+	errs := []error{}
+	fields := getConfigFields(configType)
+
+	fieldsByName := map[string]configField{}
+	knownKeys := []string{}
+	for _, field := range fields {
+		fieldsByName[field.Name] = field
+		knownKeys = append(knownKeys, field.Name)
+	}
+	sort.Strings(knownKeys)
+
+	for _, key := range node.Keys {
+		name := key.Value.(string)
+		value := node.Fields[name]
+		field, found := fieldsByName[name]
+		if !found {
+			errs = append(errs, newValidationError(file, key, "unknown key %q. Allowed keys are %s", name, strings.Join(knownKeys, ", ")))
+			continue
+		}
+
+		if expectedKind, ok := getExpectedNodeKind(field.Type); ok && value.Kind != expectedKind && value.Kind != nullNode {
+			errs = append(errs, newValidationError(file, value, "expected %s to be a %s, but found %s", name, expectedKind, value.Kind))
+			continue
+		}
+
+		if len(field.Enum) > 0 && value.Kind == stringNode && !containsString(field.Enum, value.Value.(string)) {
+			errs = append(errs, newValidationError(file, value, "invalid value %q for %s. Allowed values are %s", value.Value, name, strings.Join(field.Enum, ", ")))
+		}
+	}
+
+	for _, field := range fields {
+		value, found := node.Fields[field.Name]
+		if field.Required && (!found || value.Kind == nullNode || value.Value == "") {
+			errs = append(errs, newValidationError(file, node, "missing required key %q", field.Name))
+		}
+	}
+
+	return errs
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func validateTestConfig(t *testing.T, content string) []error {
+	node, err := parseJSONConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validateConfigurationNode("ytbdsettings.json", node)
+}
+
+func TestValidateConfigurationNodeAllowsDeploy(t *testing.T) {
+	if errs := validateTestConfig(t, `{"servicename": "api", "deploy": {}}`); len(errs) > 0 {
+		t.Errorf("expected deploy to be allowed, got %v", errs)
+	}
+}
+
+func TestValidateConfigurationNodeReportsPositions(t *testing.T) {
+	errs := validateTestConfig(t, "{\n  \"servicename\": \"api\",\n  \"replicas\": 2\n}")
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "ytbdsettings.json:3:3: unknown key \"replicas\"") {
+		t.Errorf("expected the unknown key replicas at 3:3, got %v", errs)
+	}
+
+	errs = validateTestConfig(t, `{"builder": {"type": "manual"}}`)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing required key \"servicename\"") {
+		t.Errorf("expected servicename to be required, got %v", errs)
+	}
+}